@@ -0,0 +1,171 @@
+package unboundedchannel
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrExpired is returned by Delivery.Ack once the delivery can no longer be acknowledged, because its
+// visibility timeout passed and the message was delivered again, or because it was acknowledged already.
+var ErrExpired = errors.New("unboundedchannel: delivery expired or already acknowledged")
+
+// Delivery is a message handed out by Queue.Receive in the at-least-once mode set by WithAck.
+type Delivery[T any] struct {
+	Value   T
+	Attempt int // How many times the message was delivered, this time included
+
+	id uint64
+	q  *Queue[T]
+}
+
+// Receive removes the message at the head of the queue like Pop, and hands it out as a Delivery that must be
+// acknowledged with Ack before the visibility timeout set by WithAck, or it is delivered again.
+// It returns false once the queue is closed, drained and every delivery acknowledged, or if ctx is done first.
+// Receive panics unless the queue was created with WithAck.
+func (q *Queue[T]) Receive(ctx context.Context) (Delivery[T], bool) {
+	if q.b.leases == nil {
+		panic("unboundedchannel: Receive needs WithAck")
+	}
+
+	reply := make(chan Delivery[T], 1)
+
+	select {
+	case q.b.receives <- reply:
+		d := <-reply
+		d.q = q
+
+		return d, true
+	case <-q.b.done:
+		return Delivery[T]{}, false
+	case <-ctx.Done():
+		return Delivery[T]{}, false
+	}
+}
+
+// Ack acknowledges the delivery, so its message is never delivered again.
+// It returns ErrExpired if the visibility timeout passed first, and ErrClosed if the queue has stopped.
+func (d Delivery[T]) Ack() error {
+	return d.settle(false)
+}
+
+// Nack gives up on the delivery, so its message goes back to the queue for another attempt right away,
+// instead of once the visibility timeout passes, unless WithMaxAttempts says it had enough.
+// It returns ErrExpired if the visibility timeout passed first, and ErrClosed if the queue has stopped.
+func (d Delivery[T]) Nack() error {
+	return d.settle(true)
+}
+
+func (d Delivery[T]) settle(requeue bool) error {
+	reply := make(chan bool, 1)
+
+	select {
+	case d.q.b.acks <- ack{id: d.id, requeue: requeue, reply: reply}:
+		if !<-reply {
+			return ErrExpired
+		}
+
+		return nil
+	case <-d.q.b.done:
+		return ErrClosed
+	}
+}
+
+// ack asks the buffering goroutine to settle a delivery, and is replied to with whether it still could.
+type ack struct {
+	id      uint64
+	requeue bool      // Set by Nack
+	reply   chan bool // Buffered, so the goroutine never blocks on it
+}
+
+// lease is a message handed out by Queue.Receive, delivered again unless acknowledged before deadline.
+type lease[T any] struct {
+	e        elem[T]
+	deadline time.Duration
+}
+
+// leases tracks the deliveries of a buffer in the mode set by WithAck. A nil *leases is empty.
+type leases[T any] struct {
+	visibility time.Duration
+	next       uint64
+	pending    map[uint64]lease[T]
+	order      *chunkList[uint64] // Ids by deadline, including those acknowledged since, skipped as they come up
+}
+
+func newLeases[T any](visibility time.Duration) *leases[T] {
+	return &leases[T]{
+		visibility: visibility,
+		pending:    make(map[uint64]lease[T]),
+		order:      newChunkList[uint64](0, nil),
+	}
+}
+
+func (l *leases[T]) len() int {
+	if l == nil {
+		return 0
+	}
+
+	return len(l.pending)
+}
+
+// add leases e until visibility from now, and returns the id to acknowledge it with.
+func (l *leases[T]) add(e elem[T], now time.Duration) uint64 {
+	l.next++
+	l.pending[l.next] = lease[T]{e: e, deadline: now + l.visibility}
+	l.order.push(l.next)
+
+	return l.next
+}
+
+// ack settles the delivery id, and returns its message if it was still pending.
+func (l *leases[T]) ack(id uint64) (elem[T], bool) {
+	le, ok := l.pending[id]
+	delete(l.pending, id)
+
+	return le.e, ok
+}
+
+// first returns the pending lease with the earliest deadline, forgetting the settled ones before it.
+func (l *leases[T]) first() (uint64, lease[T], bool) {
+	for l.len() > 0 {
+		id := l.order.peek()
+		if le, ok := l.pending[id]; ok {
+			return id, le, true
+		}
+
+		l.order.pop()
+	}
+
+	return 0, lease[T]{}, false
+}
+
+// expired removes and returns the next lease whose deadline has passed, if any.
+func (l *leases[T]) expired(now time.Duration) (elem[T], bool) {
+	id, le, ok := l.first()
+	if !ok || le.deadline > now {
+		return elem[T]{}, false
+	}
+
+	l.order.pop()
+	delete(l.pending, id)
+
+	return le.e, true
+}
+
+// until returns how long until the next lease expires, if any.
+func (l *leases[T]) until(now time.Duration) (time.Duration, bool) {
+	_, le, ok := l.first()
+	return le.deadline - now, ok
+}
+
+// drain removes and returns the messages of every pending lease, in order of deadline.
+func (l *leases[T]) drain() []T {
+	var vs []T
+	for id, le, ok := l.first(); ok; id, le, ok = l.first() {
+		l.order.pop()
+		delete(l.pending, id)
+		vs = append(vs, le.e.v)
+	}
+
+	return vs
+}
@@ -0,0 +1,112 @@
+package unboundedchannel
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// NewBatching returns a pair of channels (in, out) like NewWithContext, except that out delivers the buffered
+// messages grouped into slices of at most maxBatch, in FIFO order.
+// A batch is offered on out once it holds maxBatch messages, or maxWait after its first message arrived,
+// whichever comes first. While a batch waits for the consumer, it keeps filling up to maxBatch.
+// Closing in offers the remaining messages right away. The consumer owns each slice it receives.
+// NewBatching panics if maxBatch is less than 1.
+func NewBatching[T any](ctx context.Context, maxBatch int, maxWait time.Duration) (chan<- T, <-chan []T) {
+	if maxBatch < 1 {
+		panic("unboundedchannel: NewBatching maxBatch must be positive")
+	}
+
+	in := make(chan T)
+	out := make(chan []T)
+
+	// Start buffering
+	go bufferBatches(ctx, in, out, identity[T], maxBatch, maxWait)
+
+	return in, out
+}
+
+// NewAdaptiveBatching returns a pair of channels (in, out) like NewBatching, except that batches are sized
+// by how fast the consumer reads rather than by a timer. A batch is offered as soon as there is a message
+// and grows with every message that arrives before the consumer takes it, so a consumer that keeps up gets
+// single-message batches with no added latency, and a slow one gets everything buffered since its last read.
+// A maxBatch of 0 means batches are not limited in size.
+// NewAdaptiveBatching panics if maxBatch is negative.
+func NewAdaptiveBatching[T any](ctx context.Context, maxBatch int) (chan<- T, <-chan []T) {
+	if maxBatch < 0 {
+		panic("unboundedchannel: NewAdaptiveBatching maxBatch must not be negative")
+	}
+
+	if maxBatch == 0 {
+		maxBatch = math.MaxInt
+	}
+
+	in := make(chan T)
+	out := make(chan []T)
+
+	// Start buffering
+	go bufferBatches(ctx, in, out, identity[T], maxBatch, 0)
+
+	return in, out
+}
+
+// bufferBatches moves messages from in to out in batches of at most maxBatch, converting them with conv
+// like a buffer does. A maxWait of 0 offers every batch as soon as it has a message.
+func bufferBatches[I, T any](ctx context.Context, in <-chan I, out chan<- []T, conv func(I) (T, bool), maxBatch int, maxWait time.Duration) {
+	defer close(out)
+
+	var batch []T                         // Next batch to offer
+	pending := newChunkList[T](0, nil)    // Messages that didn't fit in batch
+	timer := stoppedTimer(clockFrom(ctx)) // Fires maxWait after batch got its first message
+	defer timer.Stop()
+	armed, waited := false, false
+
+	for {
+		// Top up the batch from the messages that didn't fit earlier
+		for len(batch) < maxBatch && pending.len() > 0 {
+			batch = append(batch, pending.pop())
+		}
+
+		if len(batch) == 0 {
+			if in == nil {
+				return // Intake is closed and everything was delivered
+			}
+		} else if !armed && maxWait > 0 {
+			timer.Reset(maxWait)
+			armed = true
+		}
+
+		// Only offer the batch once it is full or has waited long enough
+		var send chan<- []T
+		if len(batch) > 0 && (len(batch) >= maxBatch || waited || maxWait <= 0 || in == nil) {
+			send = out
+		}
+
+		select {
+		case m, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+
+			t, ok := conv(m)
+			if !ok {
+				continue
+			}
+
+			if len(batch) < maxBatch {
+				batch = append(batch, t)
+			} else {
+				pending.push(t)
+			}
+		case send <- batch:
+			batch = nil
+			timer.Stop()
+			armed, waited = false, false
+		case <-timer.C():
+			waited = true
+		case <-ctx.Done():
+			return
+		}
+	}
+}
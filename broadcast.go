@@ -0,0 +1,146 @@
+package unboundedchannel
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Broadcaster delivers every published message to all of its subscribers, each through its own buffer, so a
+// slow subscriber only holds up the others if its options make it block.
+// Publishing never blocks: messages are buffered before they are fanned out.
+type Broadcaster[T any] struct {
+	ctx    context.Context
+	src    *Queue[T]
+	opts   []Option
+	replay int
+	subs   atomic.Uint64 // Subscriptions so far, numbering the names of their buffers
+
+	subscribe   chan *subscriber[T]
+	unsubscribe chan *subscriber[T]
+	done        chan struct{} // Closed once the dispatching goroutine has exited
+}
+
+// subscriber is the buffer of a single subscription.
+type subscriber[T any] struct {
+	q      *Queue[T]
+	cancel context.CancelFunc
+}
+
+// NewBroadcaster returns a Broadcaster whose subscribers are buffered according to opts,
+// for example WithCapacity and WithOverflow to bound how far a slow subscriber may fall behind.
+// WithReplay sets how many recent messages a late subscriber receives when it subscribes.
+// The provided ctx is used to cancel any pending operations and terminate all subscriptions early.
+func NewBroadcaster[T any](ctx context.Context, opts ...Option) *Broadcaster[T] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	b := &Broadcaster[T]{
+		ctx:         ctx,
+		src:         NewQueue[T](ctx),
+		opts:        opts,
+		replay:      o.replay,
+		subscribe:   make(chan *subscriber[T]),
+		unsubscribe: make(chan *subscriber[T]),
+		done:        make(chan struct{}),
+	}
+
+	// Start dispatching
+	go b.run()
+
+	return b
+}
+
+// Publish sends v to every current subscriber. It never blocks, and returns ErrClosed once the
+// Broadcaster is closed, or ctx.Err() if ctx is done first.
+func (b *Broadcaster[T]) Publish(ctx context.Context, v T) error {
+	return b.src.Push(ctx, v)
+}
+
+// Close stops accepting messages. Once the messages already published are delivered to subscribers,
+// each subscription channel is closed after its buffer drains.
+func (b *Broadcaster[T]) Close() {
+	b.src.Close()
+}
+
+// Subscribe returns a channel that receives every message published from now on, preceded by up to
+// WithReplay recent ones. opts are applied to this subscriber's buffer after the Broadcaster's, and the names
+// set by WithName and WithExpvar get the number of the subscription appended, as in name/sub-1.
+// Calling cancel stops the subscription, discards anything still buffered for it and closes the channel.
+// Subscribing to a closed Broadcaster returns a closed channel.
+func (b *Broadcaster[T]) Subscribe(opts ...Option) (sub <-chan T, cancel func()) {
+	ctx, stop := context.WithCancel(b.ctx)
+	suffix := "/sub-" + strconv.FormatUint(b.subs.Add(1), 10)
+	s := &subscriber[T]{
+		q:      NewQueue[T](ctx, append(append(b.opts[:len(b.opts):len(b.opts)], opts...), withSuffix(suffix))...),
+		cancel: stop,
+	}
+
+	select {
+	case b.subscribe <- s:
+	case <-b.done:
+		s.q.Close()
+	}
+
+	var once sync.Once
+	return s.q.Out(), func() {
+		once.Do(func() {
+			stop()
+
+			select {
+			case b.unsubscribe <- s:
+			case <-b.done:
+			}
+		})
+	}
+}
+
+func (b *Broadcaster[T]) run() {
+	defer close(b.done)
+
+	subs := make(map[*subscriber[T]]struct{})
+	defer func() {
+		for s := range subs {
+			s.q.Close()
+		}
+	}()
+
+	var recent []T
+
+	for {
+		select {
+		case v, ok := <-b.src.Out():
+			if !ok {
+				return // Closed and everything published was fanned out
+			}
+
+			if b.replay > 0 {
+				if len(recent) == b.replay {
+					recent[0] = *new(T)
+					recent = recent[1:]
+				}
+
+				recent = append(recent, v)
+			}
+
+			for s := range subs {
+				if err := s.q.Push(b.ctx, v); err != nil {
+					delete(subs, s)
+				}
+			}
+		case s := <-b.subscribe:
+			for _, v := range recent {
+				s.q.Push(b.ctx, v)
+			}
+
+			subs[s] = struct{}{}
+		case s := <-b.unsubscribe:
+			delete(subs, s)
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package unboundedchannel
+
+import (
+	"context"
+	"expvar"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// expvarRuns numbers the runs of tests publishing expvar variables.
+var expvarRuns atomic.Uint64
+
+func TestBroadcasterNamesPerSubscriber(t *testing.T) {
+	// Published variables can't be removed, so every run needs names of its own
+	prefix := "test.broadcast." + strconv.FormatUint(expvarRuns.Add(1), 10)
+	r := NewRegistry()
+	b := NewBroadcaster[int](context.Background(), WithExpvar(prefix),
+		WithName("broadcast"), WithRegistry(r))
+	defer b.Close()
+
+	_, cancel1 := b.Subscribe()
+	defer cancel1()
+	_, cancel2 := b.Subscribe()
+	defer cancel2()
+
+	for _, name := range []string{prefix + "/sub-1", prefix + "/sub-2"} {
+		if expvar.Get(name) == nil {
+			t.Errorf("%s not published", name)
+		}
+	}
+
+	if got := r.Names(); !slices.Equal(got, []string{"broadcast/sub-1", "broadcast/sub-2"}) {
+		t.Errorf("registry lists %v", got)
+	}
+}
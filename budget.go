@@ -0,0 +1,82 @@
+package unboundedchannel
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Budget is a limit on the total size of the messages buffered by every buffer sharing it, as measured by
+// WithSizer, for example to cap the memory held by all the queues of a process. Buffers share a Budget with
+// WithBudget, and treat it as they treat WithMaxWeight.
+type Budget struct {
+	max  int64
+	used atomic.Int64
+
+	mu     sync.Mutex
+	wanted atomic.Bool   // Whether a blocked buffer waits on freed, so releases skip mu otherwise
+	freed  chan struct{} // Closed when some of the budget is released while wanted, guarded by mu
+}
+
+// NewBudget returns a Budget of max. NewBudget panics if max is less than 1.
+func NewBudget(max int) *Budget {
+	if max < 1 {
+		panic("unboundedchannel: budget must be positive")
+	}
+
+	return &Budget{max: int64(max), freed: make(chan struct{})}
+}
+
+// Max returns the size of the budget.
+func (g *Budget) Max() int {
+	return int(g.max)
+}
+
+// Used returns the total size of the messages buffered against the budget.
+func (g *Budget) Used() int {
+	return int(g.used.Load())
+}
+
+// fits reports whether size more fits in the budget.
+func (g *Budget) fits(size int) bool {
+	return g.used.Load()+int64(size) <= g.max
+}
+
+// exhausted reports whether the budget is used up.
+func (g *Budget) exhausted() bool {
+	return g.used.Load() >= g.max
+}
+
+// charge adds n, which may be negative, to the budget in use, and wakes up blocked buffers if it decreased.
+func (g *Budget) charge(n int) {
+	g.used.Add(int64(n))
+
+	if n >= 0 || !g.wanted.Load() {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.wanted.Load() {
+		close(g.freed)
+		g.freed = make(chan struct{})
+		g.wanted.Store(false)
+	}
+}
+
+// wait returns a channel that is closed once some of the budget is released, or one that is ready right away
+// if the budget is no longer exhausted, so a buffer blocked on it never misses a release.
+func (g *Budget) wait() <-chan struct{} {
+	g.mu.Lock()
+	g.wanted.Store(true)
+	freed := g.freed
+	g.mu.Unlock()
+
+	// Either a release sees wanted, or this sees the release
+
+	if !g.exhausted() {
+		return closed
+	}
+
+	return freed
+}
@@ -0,0 +1,1212 @@
+package unboundedchannel
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"math/rand/v2"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// buffer holds the state shared with the goroutine that moves messages from in to out,
+// converting each one from I to T with conv on the way in, or discarding it if conv reports false.
+type buffer[I, T any] struct {
+	ctx    context.Context
+	opts   options
+	in     chan I
+	mpsc   *mpsc[I] // Fed by Queue.Push with WithMPSC
+	src    <-chan I // Where the goroutine reads messages from: in, unless wrapping a channel with Buffer
+	inAll  chan []I // Fed by Queue.PushAll
+	out    chan T
+	takes  chan take[T]       // Fed by Queue.PopUpTo
+	peeks  chan chan T        // Fed by Queue.Peek, replied to with the head
+	polls  chan take[T]       // Fed by Queue.TryPop
+	tries  chan try[I]        // Fed by Queue.TryPush
+	flush  chan chan struct{} // Fed by Queue.Flush, closed once everything received so far has left
+	pause  chan bool          // Fed by Queue.Pause and Queue.Resume
+	freeze chan bool          // Fed by Queue.Freeze and Queue.Unfreeze
+	resets chan chan int      // Fed by Queue.Reset, replied to with the number of messages cleared
+	snaps  chan snap[T]       // Fed by Queue.Snapshot and Queue.Inspect
+	fronts chan T             // Fed by Queue.PushFront
+
+	// Fed by Queue.Receive and Delivery.Ack, only made with WithAck
+	receives chan chan Delivery[T]
+	acks     chan ack
+
+	// Channels out is delivered through in turn, starting with out itself
+	outs []chan T
+	next int
+
+	closeOut func() // Called as the goroutine exits, closes outs unless they are shared with other buffers
+
+	// Owned by the goroutine once started
+	conv     func(I) (T, bool)
+	keep     func(T) bool
+	store    store[elem[T]]
+	weights  *weighed[T] // The store itself, if WithSizer is set
+	clock    Clock       // Set by WithClock or ContextWithClock
+	epoch    time.Time   // Start of the buffer, which elem.at is relative to
+	onExpire func(T)
+	onDrop   func(T)
+	due      func(T) time.Time
+
+	onEnqueue func(T)
+	onDequeue func(T)
+
+	stamped bool              // Whether elem.at is set
+	latency *latencyHistogram // Set by WithLatency
+	meter   *rateMeter        // Set by WithRates
+	leases  *leases[T]        // Set by WithAck
+	limit   *limiter          // Set by WithRateLimit
+	chaos   *chaos            // Set by WithChaos
+	front   *fronted[T]       // The store itself, once WithRequeueFront or Queue.PushFront needs it
+
+	onExhausted func(T)
+	deadLetter  func(T, DeadReason)
+
+	seen uint64 // Messages considered for the sample of WithSampleEvery
+
+	above bool // Whether the length reached the high watermark and hasn't fallen to the low one since
+
+	log     *slog.Logger // Set by WithLogger
+	atCap   bool         // Whether reaching capacity was logged since the buffer last had room
+	stuck   bool         // Whether WithWatchdog reported the head since it last was younger than the threshold
+	growLog int          // Length at which to log growth next
+
+	closing   chan struct{} // Closed by Queue.Close or WithIdleTimeout; stops intake like closing in
+	closeOnce sync.Once     // Guards closing
+	done      chan struct{} // Closed as the goroutine exits, just before out
+	stop      chan struct{} // Closed to make the goroutine exit right away
+	err       error         // Why the goroutine exited early, readable once done is closed
+
+	idleTimeout time.Duration // Set by NewQueue from WithIdleTimeout
+
+	discarded int // Messages left undelivered on exit, readable once done is closed
+
+	// Messages handed to the goroutine so far, and the flushes waiting for some of them to leave
+	received uint64
+	flushes  []flush
+
+	length     atomic.Int64  // Messages currently buffered
+	headAt     atomic.Int64  // elem.at of the head, while stamped and not empty
+	weight     atomic.Int64  // Total size of the messages currently buffered, with WithSizer
+	enqueued   atomic.Uint64 // Messages accepted into the buffer
+	dequeued   atomic.Uint64 // Messages delivered to a consumer
+	maxLength  atomic.Int64  // Highest length since start or the last reset
+	dropped    atomic.Uint64 // Messages discarded by the overflow policy
+	duplicates atomic.Uint64 // Messages folded into a pending message with the same key
+	expired    atomic.Uint64 // Messages skipped for outliving their TTL
+	filtered   atomic.Uint64 // Messages discarded by WithFilter
+	sampled    atomic.Uint64 // Messages skipped by WithSampleEvery and WithSampleRate
+}
+
+// take asks the buffering goroutine for up to n messages at once.
+type take[T any] struct {
+	n     int
+	reply chan []T // Buffered, so the goroutine never blocks on it
+}
+
+// try offers a message to the buffering goroutine, which replies whether it accepted it without waiting.
+type try[I any] struct {
+	v     I
+	reply chan bool // Buffered, so the goroutine never blocks on it
+}
+
+// snap asks the buffering goroutine for copies of up to limit buffered messages, or all of them if limit is
+// negative.
+type snap[T any] struct {
+	limit int
+	reply chan []T // Buffered, so the goroutine never blocks on it
+}
+
+// flush is a pending Queue.Flush, released once target messages have left the buffer.
+type flush struct {
+	target uint64
+	done   chan struct{}
+}
+
+// start applies opts and starts the buffering goroutine.
+func start[T any](ctx context.Context, opts []Option) *buffer[T, T] {
+	return startConv(ctx, opts, identity[T])
+}
+
+// startConv applies opts and starts a buffering goroutine that converts messages with conv.
+func startConv[I, T any](ctx context.Context, opts []Option, conv func(I) (T, bool)) *buffer[I, T] {
+	b := newBuffer(ctx, opts, conv)
+
+	// Start buffering
+	go b.run()
+
+	return b
+}
+
+// newBuffer applies opts to a buffer that reads from its own in, without starting its goroutine.
+func newBuffer[I, T any](ctx context.Context, opts []Option, conv func(I) (T, bool)) *buffer[I, T] {
+	b := &buffer[I, T]{
+		ctx:     ctx,
+		in:      make(chan I),
+		inAll:   make(chan []I),
+		takes:   make(chan take[T]),
+		peeks:   make(chan chan T),
+		polls:   make(chan take[T]),
+		tries:   make(chan try[I]),
+		flush:   make(chan chan struct{}),
+		pause:   make(chan bool),
+		freeze:  make(chan bool),
+		resets:  make(chan chan int),
+		snaps:   make(chan snap[T]),
+		fronts:  make(chan T),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+		stop:    make(chan struct{}),
+		conv:    conv,
+	}
+	b.src = b.in
+
+	for _, opt := range opts {
+		opt(&b.opts)
+	}
+
+	b.clock = b.opts.clock
+	if b.clock == nil {
+		b.clock = clockFrom(ctx)
+	}
+	b.epoch = b.clock.Now()
+
+	b.out = make(chan T, b.opts.outBuffer)
+	b.outs = []chan T{b.out}
+	for range b.opts.roundRobin - 1 {
+		b.outs = append(b.outs, make(chan T, b.opts.outBuffer))
+	}
+
+	b.closeOut = func() {
+		for _, out := range b.outs {
+			close(out)
+		}
+	}
+
+	// Resolve element-typed options here so a mismatch panics in the constructor
+	b.store = newStore[T](&b.opts)
+	if b.opts.chaos != nil {
+		b.chaos = newChaos(*b.opts.chaos)
+		if b.chaos.Reorder > 0 {
+			b.store = newShuffled(b.store, b.chaos.Reorder, b.chaos.rand)
+		}
+	}
+	size := typedFunc[func(T) int](b.opts.sizer, "WithSizer")
+	if size == nil && b.opts.budget != nil {
+		size = func(v T) int { return int(unsafe.Sizeof(v)) }
+	}
+	if size != nil {
+		b.weights = newWeighed(b.store, size, b.opts.budget)
+		b.store = b.weights
+	} else if b.opts.maxWeight > 0 {
+		panic("unboundedchannel: WithMaxWeight needs WithSizer")
+	}
+	b.onExpire = typedFunc[func(T)](b.opts.onExpire, "WithOnExpire")
+	b.due = typedFunc[func(T) time.Time](b.opts.due, "WithDeliverAt")
+	b.keep = typedFunc[func(T) bool](b.opts.keep, "WithFilter")
+	b.onDrop = typedFunc[func(T)](b.opts.onDrop, "WithOnDrop")
+	b.onEnqueue = typedFunc[func(T)](b.opts.onEnqueue, "WithOnEnqueue")
+	b.onDequeue = typedFunc[func(T)](b.opts.onDequeue, "WithOnDequeue")
+
+	if b.opts.latency {
+		b.latency = new(latencyHistogram)
+	}
+	if b.opts.rates > 0 {
+		b.meter = newRateMeter(b.opts.rates)
+	}
+	if b.opts.rateInterval > 0 {
+		b.limit = &limiter{interval: b.opts.rateInterval, burst: b.opts.rateBurst}
+	}
+
+	if b.opts.visibility > 0 {
+		b.leases = newLeases[T](b.opts.visibility)
+		b.receives, b.acks = make(chan chan Delivery[T]), make(chan ack)
+
+		if b.opts.requeueFront {
+			b.fronted()
+		}
+	}
+	b.onExhausted = typedFunc[func(T)](b.opts.onExhausted, "WithMaxAttempts")
+	b.deadLetter = typedFunc[func(T, DeadReason)](b.opts.deadLetter, "WithDeadLetter")
+
+	b.stamped = b.opts.ttl > 0 || b.opts.onWait != nil || b.latency != nil || b.opts.registry != nil || b.opts.stuckAfter > 0
+
+	if b.opts.logger != nil {
+		b.log, b.growLog = b.opts.logger, 1024
+		if b.opts.name != "" {
+			b.log = b.log.With("queue", b.opts.name)
+		}
+	}
+
+	if b.opts.expvarName != "" {
+		expvar.Publish(b.opts.expvarName, expvar.Func(b.vars))
+	}
+
+	if b.opts.registry != nil {
+		if b.opts.name == "" {
+			panic("unboundedchannel: WithRegistry needs WithName")
+		}
+
+		b.opts.registry.add(b.opts.name, b)
+	}
+
+	return b
+}
+
+func (b *buffer[I, T]) run() {
+	b.label()
+
+	// Close done first, so b.err is visible to anyone who sees out closed
+	defer b.closeOut()
+	defer close(b.done)
+
+	in, inAll, closing := b.src, b.inAll, b.closing
+	cancelled := b.ctx.Done()
+	policy, ttl := b.opts.overflow, b.opts.ttl
+
+	// Fires when the time allowed by WithDrainOnCancel is up
+	var drained <-chan time.Time
+
+	buffer := b.store
+	fails, _ := buffer.(failing)
+
+	// Messages from PushAll waiting for room in a full, blocking buffer
+	var backlog []I
+
+	// Whether delivery is held by Queue.Pause, and intake by Queue.Freeze
+	paused, frozen := false, false
+
+	// Polls left before parking in select, as set by WithSpin
+	spins := b.opts.spin
+
+	// Count what is left undelivered, whatever the reason to exit
+	defer func() {
+		// Pushes through WithMPSC that already returned are counted like any other buffered message
+		b.closeMPSC()
+
+		b.discarded = buffer.len() + len(backlog) + b.leases.len()
+		b.releaseFlushes(b.discarded)
+
+		if r, ok := buffer.(retainer); ok {
+			r.retain()
+		}
+
+		// The hook that panicked in the loop may well panic again, which stops reporting the rest
+		if b.onDrop != nil || b.deadLetter != nil {
+			b.protect(func() {
+				for buffer.len() > 0 {
+					b.drop(buffer.pop().v, DeadUndelivered)
+				}
+
+				for _, t := range backlog {
+					if v, ok := b.conv(t); ok {
+						b.drop(v, DeadUndelivered)
+					}
+				}
+
+				if b.leases != nil {
+					for _, v := range b.leases.drain() {
+						b.drop(v, DeadUndelivered)
+					}
+				}
+			})
+		}
+
+		if b.weights != nil {
+			b.weights.release()
+		}
+
+		if c, ok := buffer.(closer); ok {
+			c.close()
+		}
+
+		if b.log != nil && b.discarded > 0 {
+			b.log.Warn("unboundedchannel: stopped with messages undelivered", "discarded", b.discarded, "cause", b.err)
+		}
+
+		if b.opts.onClose != nil {
+			b.protect(func() {
+				b.opts.onClose(b.discarded)
+			})
+		}
+
+		if b.opts.registry != nil {
+			b.opts.registry.remove(b.opts.name, b)
+		}
+	}()
+
+	// Fires when the head outlives its TTL or becomes due
+	var timer Timer
+	var armed bool
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	// Fires once no message was received for WithIdleTimeout
+	var idle Timer
+	var lastReceived uint64
+	var receivedAt time.Duration
+	if b.idleTimeout > 0 {
+		idle = b.clock.NewTimer(b.idleTimeout)
+		defer idle.Stop()
+
+		receivedAt = b.now()
+	}
+
+	// Deferred last, so the rest of the exit runs as usual once the panic is recovered, with its own hooks
+	// protected the same way
+	if b.opts.onPanic != nil {
+		defer b.recoverPanic(false)
+	}
+
+	for {
+		// Deliveries not acknowledged in time go back to the queue, before anything expires
+		if b.leases != nil {
+			b.redeliver()
+		}
+
+		if ttl > 0 {
+			b.expire()
+		}
+
+		for len(backlog) > 0 && !b.full() {
+			b.accept(backlog[0])
+			backlog[0] = *new(I)
+			backlog = backlog[1:]
+		}
+
+		// Stop reading from in while the buffer is full, unless there is a policy for overflow
+		recv, recvAll := in, inAll
+		var freed <-chan struct{}
+		if frozen || len(backlog) > 0 || (b.full() && policy == Block) {
+			recv, recvAll = nil, nil
+
+			// Other buffers sharing the budget may make room for this one, if nothing else holds intake
+			if !frozen && b.blockedByBudget() {
+				freed = b.opts.budget.wait()
+			}
+		}
+
+		// Only offer a message to out when there is one, and it is due
+		var send chan<- T
+		var head elem[T]
+		wait := time.Duration(-1)
+		if buffer.len() > 0 {
+			head = buffer.peek()
+
+			if d := b.untilDue(head); d > 0 {
+				wait = d
+			} else {
+				if !paused {
+					send = b.outs[b.next]
+				}
+
+				if ttl > 0 {
+					wait = head.at + ttl - b.now()
+				}
+			}
+		} else if in == nil && len(backlog) == 0 && b.leases.len() == 0 {
+			return // Intake is closed, the buffer is drained and every delivery acknowledged
+		}
+
+		if d, ok := b.leases.until(b.now()); ok && (wait < 0 || d < wait) {
+			wait = d
+		}
+
+		// Report a head that is offered but not taken for too long, once until the consumer catches up
+		if b.opts.stuckAfter > 0 {
+			if d := b.watch(send != nil, head); d >= 0 && (wait < 0 || d < wait) {
+				wait = d
+			}
+		}
+
+		// A store that can no longer keep its messages safe stops the buffer
+		if fails != nil {
+			if err := fails.failure(); err != nil {
+				b.err = err
+				return
+			}
+		}
+
+		// Non-blocking writes are answered whenever intake is open
+		tries := b.tries
+		var notify <-chan struct{}
+		if b.mpsc != nil {
+			notify = b.mpsc.notify
+		}
+		if in == nil {
+			tries, notify = nil, nil
+		}
+
+		// Bulk consumers and peeks are served under the same conditions as out
+		var takes <-chan take[T]
+		var peeks <-chan chan T
+		var receives <-chan chan Delivery[T]
+		if send != nil {
+			takes, peeks, receives = b.takes, b.peeks, b.receives
+		}
+
+		// The idle timer only starts over when it fires, from the last time a message was received
+		var idled <-chan time.Time
+		if idle != nil && in != nil {
+			if b.received != lastReceived {
+				lastReceived, receivedAt = b.received, b.now()
+			}
+
+			idled = idle.C()
+		}
+
+		// While spinning, poll is always ready, so select never parks
+		var poll <-chan struct{}
+		if spins > 0 {
+			poll = closed
+		}
+
+		var wake <-chan time.Time
+		if wait >= 0 {
+			if timer == nil {
+				timer = b.clock.NewTimer(wait)
+			} else {
+				timer.Reset(wait)
+			}
+
+			wake, armed = timer.C(), true
+		} else if armed {
+			// Nothing is left to wait for, so don't wake up for nothing, which a fake clock would act on
+			timer.Stop()
+			armed = false
+		}
+
+		select {
+		case t, ok := <-recv:
+			// When in is closed, keep writing out the rest of the messages
+			if !ok {
+				in, inAll, closing = nil, nil, nil
+				continue
+			}
+
+			b.received++
+			b.accept(t)
+		case ts := <-recvAll:
+			b.received += uint64(len(ts))
+
+			// Take what fits, and hold back the rest
+			i := 0
+			for ; i < len(ts) && (policy != Block || !b.full()); i++ {
+				b.accept(ts[i])
+			}
+
+			backlog = ts[i:]
+		case <-closing:
+			in, inAll, closing = nil, nil, nil
+			b.closeMPSC()
+		case <-notify:
+			b.drainMPSC()
+		case send <- head.v:
+			buffer.pop()
+			b.deliver(head)
+			b.next = (b.next + 1) % len(b.outs)
+
+			// Keep going while out takes messages without waiting, rather than selecting again for each one
+			b.fill()
+		case t := <-takes:
+			t.reply <- b.take(t.n)
+		case reply := <-receives:
+			buffer.pop()
+			b.deliver(head)
+
+			head.attempts++
+			reply <- Delivery[T]{Value: head.v, Attempt: head.attempts, id: b.leases.add(head, b.now())}
+		case a := <-b.acks:
+			e, ok := b.leases.ack(a.id)
+			if ok && a.requeue {
+				b.requeue(e)
+			}
+
+			a.reply <- ok
+		case t := <-b.polls:
+			// Answered right away, with nothing unless out could be served
+			var batch []T
+			if send != nil {
+				batch = b.take(t.n)
+			}
+
+			t.reply <- batch
+		case t := <-tries:
+			b.drainMPSC()
+			ok := !frozen && len(backlog) == 0 && (policy != Block || !b.full())
+			if ok {
+				b.received++
+				b.accept(t.v)
+			}
+
+			t.reply <- ok
+		case done := <-b.flush:
+			b.drainMPSC()
+			b.flushes = append(b.flushes, flush{target: b.received, done: done})
+		case reply := <-peeks:
+			reply <- head.v
+		case paused = <-b.pause:
+		case frozen = <-b.freeze:
+		case reply := <-b.resets:
+			n := buffer.len() + len(backlog)
+			for buffer.len() > 0 {
+				buffer.pop()
+			}
+
+			clear(backlog)
+			backlog = nil
+
+			reply <- n
+		case v := <-b.fronts:
+			e := elem[T]{v: v}
+			if b.stamped {
+				e.at = b.now()
+			}
+
+			b.received++
+			b.fronted().pushFront(e)
+			buffer = b.store
+		case req := <-b.snaps:
+			snapshot := b.snapshot(req.limit)
+			for _, t := range backlog {
+				if req.limit >= 0 && len(snapshot) >= req.limit {
+					break
+				}
+
+				if v, ok := b.conv(t); ok {
+					snapshot = append(snapshot, v)
+				}
+			}
+
+			req.reply <- snapshot
+		case <-wake:
+			// The head is skipped or offered on the next iteration
+			armed = false
+		case <-cancelled:
+			b.err = context.Cause(b.ctx)
+			if b.opts.drainTimeout <= 0 {
+				return
+			}
+
+			// Keep delivering what was already accepted for a while
+			drain := b.clock.NewTimer(b.opts.drainTimeout)
+			defer drain.Stop()
+
+			in, inAll, closing, cancelled = nil, nil, nil, nil
+			drained = drain.C()
+		case <-drained:
+			return
+		case <-idled:
+			if left := receivedAt + b.idleTimeout - b.now(); left > 0 {
+				idle.Reset(left)
+				continue
+			}
+
+			b.err = ErrIdle
+			if !b.opts.idleDrain {
+				return
+			}
+
+			b.closeOnce.Do(func() {
+				close(b.closing)
+			})
+		case <-b.stop:
+			return
+		case <-freed:
+			// Checked for room on the next iteration
+		case <-poll:
+			// Let a producer or consumer sharing the thread make progress in the meantime
+			spins--
+			runtime.Gosched()
+			continue
+		}
+
+		spins = b.opts.spin
+
+		b.setLength(buffer.len())
+		b.releaseFlushes(buffer.len() + len(backlog))
+	}
+}
+
+// drainMPSC accepts the messages pushed through WithMPSC so far.
+func (b *buffer[I, T]) drainMPSC() {
+	if b.mpsc == nil {
+		return
+	}
+
+	b.mpsc.drain(func(t I) {
+		b.received++
+		b.accept(t)
+	})
+}
+
+// closeMPSC accepts the last messages pushed through WithMPSC once intake is closed. Pushes that start from
+// now on see the queue closed, so only those in progress need waiting for.
+func (b *buffer[I, T]) closeMPSC() {
+	if b.mpsc == nil {
+		return
+	}
+
+	for b.mpsc.inflight.Load() > 0 {
+		runtime.Gosched()
+	}
+
+	b.drainMPSC()
+}
+
+// releaseFlushes releases the flushes whose messages have all left the buffer, given how many are pending.
+// Flushes are kept in the order they arrived, which is also the order of their targets.
+func (b *buffer[I, T]) releaseFlushes(pending int) {
+	left := b.received - uint64(pending)
+
+	for len(b.flushes) > 0 && b.flushes[0].target <= left {
+		close(b.flushes[0].done)
+		b.flushes = b.flushes[1:]
+	}
+}
+
+// closed is a channel that is always ready to receive from.
+var closed = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// identity is the conversion of buffers that don't convert.
+func identity[T any](v T) (T, bool) {
+	return v, true
+}
+
+// full reports whether the buffer holds as many messages as WithCapacity allows, or as much weight as
+// WithMaxWeight or WithBudget allows.
+func (b *buffer[I, T]) full() bool {
+	return b.atCapacity() || (b.opts.maxWeight > 0 && b.weights.total >= b.opts.maxWeight) ||
+		(b.opts.budget != nil && b.opts.budget.exhausted())
+}
+
+// blockedByBudget reports whether the budget alone keeps a blocking buffer from taking more messages, so it
+// has to wait for the buffers sharing it to release some.
+func (b *buffer[I, T]) blockedByBudget() bool {
+	return b.opts.budget != nil && b.opts.overflow == Block && !b.atCapacity() &&
+		(b.opts.maxWeight == 0 || b.weights.total < b.opts.maxWeight) && b.opts.budget.exhausted()
+}
+
+// fits reports whether a message of size fits within WithMaxWeight and WithBudget.
+func (b *buffer[I, T]) fits(size int) bool {
+	return (b.opts.maxWeight == 0 || b.weights.total+size <= b.opts.maxWeight) &&
+		(b.opts.budget == nil || b.opts.budget.fits(size))
+}
+
+// atCapacity reports whether the buffer holds as many messages as WithCapacity allows, regardless of weight.
+func (b *buffer[I, T]) atCapacity() bool {
+	return b.opts.capacity > 0 && b.store.len() >= b.opts.capacity
+}
+
+// accept converts and buffers a message read from the producer, unless it is filtered out, applying the
+// overflow policy if the buffer is full.
+func (b *buffer[I, T]) accept(t I) {
+	v, ok := b.conv(t)
+	if !ok || (b.keep != nil && !b.keep(v)) {
+		b.filtered.Add(1)
+		return
+	}
+
+	if b.skip() {
+		b.sampled.Add(1)
+		return
+	}
+
+	if b.chaos != nil && b.chaos.drop() {
+		b.dropped.Add(1)
+		b.drop(v, DeadDropped)
+		return
+	}
+
+	// Make room by weight first, where a blocking buffer already waited for room before reading
+	if b.weights != nil && b.opts.overflow != Block {
+		size := b.weights.size(v)
+		for b.store.len() > 0 && !b.fits(size) {
+			b.dropped.Add(1)
+
+			if b.opts.overflow == DropNewest {
+				b.drop(v, DeadDropped)
+				return
+			}
+
+			b.drop(b.store.pop().v, DeadDropped)
+		}
+	}
+
+	e := elem[T]{v: v}
+	if b.stamped {
+		e.at = b.now()
+	}
+
+	// A message folded into a pending one takes no room, so nothing needs to go
+	if b.atCapacity() && !folds(b.store, e) {
+		b.dropped.Add(1)
+
+		if b.opts.overflow == DropNewest {
+			b.drop(v, DeadDropped)
+			return
+		}
+
+		b.drop(b.store.pop().v, DeadDropped)
+	}
+
+	// A keyed store folds a message into a pending one instead of growing
+	n := b.store.len()
+	b.store.push(e)
+	if b.store.len() == n {
+		b.duplicates.Add(1)
+	}
+
+	b.enqueued.Add(1)
+	if b.meter != nil {
+		b.meter.accepted(b.now())
+	}
+
+	if b.onEnqueue != nil {
+		b.onEnqueue(v)
+	}
+}
+
+// deliver accounts for a message handed to a consumer.
+func (b *buffer[I, T]) deliver(e elem[T]) {
+	b.dequeued.Add(1)
+	if b.meter != nil {
+		b.meter.delivered(b.now())
+	}
+
+	if b.limit != nil {
+		b.limit.take(b.now())
+	}
+	if b.chaos != nil {
+		b.chaos.take()
+	}
+
+	if b.opts.onWait != nil || b.latency != nil {
+		wait := b.now() - e.at
+
+		if b.opts.onWait != nil {
+			b.opts.onWait(wait)
+		}
+
+		if b.latency != nil {
+			b.latency.observe(wait)
+		}
+	}
+
+	if b.onDequeue != nil {
+		b.onDequeue(e.v)
+	}
+}
+
+// skip reports whether to leave out the next message from the sample set by WithSampleEvery or WithSampleRate.
+func (b *buffer[I, T]) skip() bool {
+	switch {
+	case b.opts.sampleEvery > 1:
+		b.seen++
+		return (b.seen-1)%uint64(b.opts.sampleEvery) != 0
+	case b.opts.sampleRate > 0 && b.opts.sampleRate < 1:
+		return rand.Float64() >= b.opts.sampleRate
+	default:
+		return false
+	}
+}
+
+// drop hands a message lost without being delivered to WithOnDrop and WithDeadLetter, if set.
+func (b *buffer[I, T]) drop(v T, reason DeadReason) {
+	if b.onDrop != nil {
+		b.onDrop(v)
+	}
+
+	if b.deadLetter != nil {
+		b.deadLetter(v, reason)
+	}
+}
+
+// fill hands messages that are due to out for as long as it has room or a consumer waiting.
+func (b *buffer[I, T]) fill() {
+	for {
+		if b.opts.ttl > 0 {
+			b.expire()
+		}
+
+		if b.store.len() == 0 {
+			return
+		}
+
+		head := b.store.peek()
+		if b.untilDue(head) > 0 {
+			return
+		}
+
+		select {
+		case b.outs[b.next] <- head.v:
+			b.store.pop()
+			b.deliver(head)
+			b.next = (b.next + 1) % len(b.outs)
+		default:
+			return
+		}
+	}
+}
+
+// take pops up to n messages that are due from the head of the buffer, for PopUpTo and TryPop.
+func (b *buffer[I, T]) take(n int) []T {
+	batch := make([]T, 0, min(n, b.store.len()))
+	for len(batch) < n && b.store.len() > 0 && b.untilDue(b.store.peek()) <= 0 {
+		e := b.store.pop()
+		b.deliver(e)
+		batch = append(batch, e.v)
+
+		if b.opts.ttl > 0 {
+			b.expire()
+		}
+	}
+
+	return batch
+}
+
+// redeliver puts the messages of deliveries whose visibility timeout passed back in the queue.
+func (b *buffer[I, T]) redeliver() {
+	n := b.store.len()
+	for e, ok := b.leases.expired(b.now()); ok; e, ok = b.leases.expired(b.now()) {
+		b.requeue(e)
+	}
+
+	if b.store.len() != n {
+		b.setLength(b.store.len())
+	}
+}
+
+// fronted returns the store as one that also takes messages at its front, wrapping it on first use.
+func (b *buffer[I, T]) fronted() *fronted[T] {
+	if b.front == nil {
+		b.front = newFronted(b.store, b.weights)
+		b.store = b.front
+	}
+
+	return b.front
+}
+
+// requeue puts the message of a delivery that failed back in the queue, unless it ran out of attempts.
+// It was accepted once already, so it bypasses the checks of accept, such as WithCapacity.
+func (b *buffer[I, T]) requeue(e elem[T]) {
+	switch {
+	case b.opts.maxAttempts > 0 && e.attempts >= b.opts.maxAttempts:
+		if b.onExhausted != nil {
+			b.onExhausted(e.v)
+		}
+
+		if b.deadLetter != nil {
+			b.deadLetter(e.v, DeadExhausted)
+		}
+	case b.opts.requeueFront:
+		b.front.pushFront(e)
+	default:
+		b.store.push(e)
+	}
+}
+
+// restore pushes messages saved by an earlier buffer before the goroutine starts, so they are delivered in
+// order, bypassing the checks of accept since they were accepted once already.
+func (b *buffer[I, T]) restore(items []T) {
+	if b.opts.backing == stacked {
+		items = slices.Clone(items)
+		slices.Reverse(items)
+	}
+
+	for _, v := range items {
+		e := elem[T]{v: v}
+		if b.stamped {
+			e.at = b.now()
+		}
+
+		b.store.push(e)
+	}
+
+	b.received += uint64(len(items))
+	b.enqueued.Add(uint64(len(items)))
+	b.setLength(b.store.len())
+}
+
+// snapshot returns copies of up to limit buffered messages in delivery order, or all of them if limit is
+// negative, leaving the store as it was. Stores that can walk their messages stop once they have enough. The
+// others only give access to their head, so every message is popped and then pushed back in the order that
+// rebuilds the store.
+func (b *buffer[I, T]) snapshot(limit int) []T {
+	n := b.store.len()
+	if limit >= 0 {
+		n = min(n, limit)
+	}
+
+	if canWalk(b.store) {
+		snapshot := make([]T, 0, n)
+		if n > 0 {
+			b.store.(walker[elem[T]]).walk(func(e elem[T]) bool {
+				snapshot = append(snapshot, e.v)
+				return len(snapshot) < n
+			})
+		}
+
+		return snapshot
+	}
+
+	elems := make([]elem[T], b.store.len())
+	for i := range elems {
+		elems[i] = b.store.pop()
+	}
+
+	snapshot := make([]T, len(elems))
+	for i, e := range elems {
+		snapshot[i] = e.v
+	}
+
+	if b.opts.backing == stacked {
+		slices.Reverse(elems)
+	}
+
+	for _, e := range elems {
+		b.store.push(e)
+	}
+
+	if len(snapshot) > n {
+		snapshot = slices.Clone(snapshot[:n])
+	}
+
+	return snapshot
+}
+
+// now returns the time elapsed since the buffer started.
+func (b *buffer[I, T]) now() time.Duration {
+	return b.clock.Now().Sub(b.epoch)
+}
+
+// untilDue returns how long until e may be delivered, if WithDeliverAt, WithRateLimit or WithChaos is set.
+func (b *buffer[I, T]) untilDue(e elem[T]) time.Duration {
+	var d time.Duration
+	if b.due != nil {
+		d = b.due(e.v).Sub(b.clock.Now())
+	}
+
+	if b.limit != nil {
+		d = max(d, b.limit.wait(b.now()))
+	}
+	if b.chaos != nil {
+		d = max(d, b.chaos.wait(b.now()))
+	}
+
+	return d
+}
+
+// expire skips messages at the head of the buffer that have outlived the TTL.
+func (b *buffer[I, T]) expire() {
+	now, n := b.now(), b.store.len()
+
+	for b.store.len() > 0 && now-b.store.peek().at >= b.opts.ttl {
+		e := b.store.pop()
+		b.expired.Add(1)
+
+		if b.onExpire != nil {
+			b.onExpire(e.v)
+		}
+
+		if b.deadLetter != nil {
+			b.deadLetter(e.v, DeadExpired)
+		}
+	}
+
+	if b.store.len() != n {
+		b.setLength(b.store.len())
+	}
+}
+
+// setLength publishes the current length and raises the high-water mark if needed.
+func (b *buffer[I, T]) setLength(n int) {
+	b.length.Store(int64(n))
+	if b.stamped && n > 0 {
+		b.headAt.Store(int64(b.store.peek().at))
+	}
+	if b.weights != nil {
+		b.weight.Store(int64(b.weights.total))
+	}
+
+	if int64(n) > b.maxLength.Load() {
+		b.maxLength.Store(int64(n))
+	}
+
+	if b.opts.onWatermark != nil {
+		switch {
+		case !b.above && n >= b.opts.high:
+			b.above = true
+			b.opts.onWatermark(true)
+		case b.above && n <= b.opts.low:
+			b.above = false
+			b.opts.onWatermark(false)
+		}
+	}
+
+	if b.log != nil {
+		b.logLength(n)
+	}
+}
+
+// logLength logs reaching capacity once each time it happens, and growth past each new power of two.
+func (b *buffer[I, T]) logLength(n int) {
+	switch {
+	case b.opts.capacity > 0 && n >= b.opts.capacity:
+		if !b.atCap {
+			b.atCap = true
+			b.log.Warn("unboundedchannel: buffer full", "capacity", b.opts.capacity, "policy", b.opts.overflow,
+				"dropped", b.dropped.Load())
+		}
+	case b.atCap:
+		b.atCap = false
+	}
+
+	if n >= b.growLog {
+		for n >= b.growLog {
+			b.growLog *= 2
+		}
+
+		b.log.Warn("unboundedchannel: buffer growing, the consumer may be slow", "length", n)
+	}
+}
+
+// recoverPanic stops the buffer with a PanicError when a func it calls panics, for WithOnPanic.
+// It must be deferred by run, or by protect while the buffer exits, in which case it keeps the error the buffer
+// stopped with, if any.
+func (b *buffer[I, T]) recoverPanic(exiting bool) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	err := &PanicError{Value: v, Stack: debug.Stack()}
+	if !exiting || b.err == nil {
+		b.err = err
+	}
+	b.opts.onPanic(err)
+}
+
+// protect runs fn, recovering a panic for WithOnPanic like the loop of the buffering goroutine does.
+func (b *buffer[I, T]) protect(fn func()) {
+	if b.opts.onPanic != nil {
+		defer b.recoverPanic(true)
+	}
+
+	fn()
+}
+
+// watch checks the head for WithWatchdog, if it is offered, and returns how long until it would be stuck, or
+// -1 if there is nothing to wait for.
+func (b *buffer[I, T]) watch(offered bool, head elem[T]) time.Duration {
+	if !offered {
+		b.stuck = false
+		return -1
+	}
+
+	if age := b.now() - head.at; age < b.opts.stuckAfter {
+		b.stuck = false
+		return b.opts.stuckAfter - age
+	}
+
+	if !b.stuck {
+		b.stuck = true
+
+		switch {
+		case b.opts.onStuck != nil:
+			b.opts.onStuck(b.stats())
+		case b.log != nil:
+			b.log.Warn("unboundedchannel: consumer stuck", "head_age", b.now()-head.at, "length", b.store.len())
+		}
+	}
+
+	return -1
+}
+
+// label tags the goroutine with the buffer's name, if set by WithName, and element type, so goroutine profiles
+// tell buffers apart. Labels of the buffer's context are kept.
+func (b *buffer[I, T]) label() {
+	labels := []string{"unboundedchannel.type", reflect.TypeFor[T]().String()}
+	if b.opts.name != "" {
+		labels = append(labels, "unboundedchannel.queue", b.opts.name)
+	}
+
+	pprof.SetGoroutineLabels(pprof.WithLabels(b.ctx, pprof.Labels(labels...)))
+}
+
+// stats returns a snapshot of the state and counters of the buffer, for Queue.Stats and Registry.
+func (b *buffer[I, T]) stats() Stats {
+	closed := false
+	select {
+	case <-b.closing:
+		closed = true
+	case <-b.done:
+		closed = true
+	case <-b.ctx.Done():
+		closed = true
+	default:
+	}
+
+	// Only known when messages are stamped with the time they were written
+	var headAge time.Duration
+	if n := b.length.Load(); b.stamped && n > 0 {
+		headAge = b.now() - time.Duration(b.headAt.Load())
+	}
+
+	var rates Rates
+	if b.meter != nil {
+		rates = b.meter.rates(b.now())
+	}
+
+	return Stats{
+		Len:        int(b.length.Load()),
+		Cap:        b.opts.capacity,
+		Weight:     int(b.weight.Load()),
+		MaxLen:     int(b.maxLength.Load()),
+		Enqueued:   b.enqueued.Load(),
+		Dequeued:   b.dequeued.Load(),
+		Dropped:    b.dropped.Load(),
+		Duplicates: b.duplicates.Load(),
+		Expired:    b.expired.Load(),
+		Filtered:   b.filtered.Load(),
+		Sampled:    b.sampled.Load(),
+		HeadAge:    headAge,
+		Created:    b.epoch,
+		Age:        b.now(),
+		Rates:      rates,
+		Closed:     closed,
+	}
+}
+
+// vars returns the statistics published by WithExpvar.
+func (b *buffer[I, T]) vars() any {
+	return map[string]any{
+		"length":     b.length.Load(),
+		"max_length": b.maxLength.Load(),
+		"capacity":   b.opts.capacity,
+		"enqueued":   b.enqueued.Load(),
+		"dequeued":   b.dequeued.Load(),
+		"dropped":    b.dropped.Load(),
+		"duplicates": b.duplicates.Load(),
+		"expired":    b.expired.Load(),
+		"filtered":   b.filtered.Load(),
+		"sampled":    b.sampled.Load(),
+	}
+}
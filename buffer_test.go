@@ -0,0 +1,38 @@
+package unboundedchannel
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOnPanicRecoversExitHooks(t *testing.T) {
+	var panics, closes atomic.Int32
+	q := NewQueue[int](context.Background(),
+		WithCapacity(2), WithOverflow(DropOldest),
+		WithOnDrop(func(int) { panic("drop") }),
+		WithOnClose(func(int) { closes.Add(1); panic("close") }),
+		WithOnPanic(func(*PanicError) { panics.Add(1) }))
+
+	// The third push drops the oldest, whose hook panics in the loop, with two messages left to report
+	q.Pause()
+	for i := range 3 {
+		q.Push(context.Background(), i)
+	}
+
+	<-q.Out()
+
+	var perr *PanicError
+	if err := q.Err(); !errors.As(err, &perr) || perr.Value != "drop" {
+		t.Fatalf("Err() = %v, want the panic of the loop", err)
+	}
+
+	// Once in the loop, once for the messages left, and once for WithOnClose
+	if n := panics.Load(); n != 3 {
+		t.Errorf("onPanic called %d times, want 3", n)
+	}
+	if n := closes.Load(); n != 1 {
+		t.Errorf("onClose called %d times, want 1", n)
+	}
+}
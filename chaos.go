@@ -0,0 +1,149 @@
+package unboundedchannel
+
+import (
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// Chaos sets the faults WithChaos injects into a buffer.
+type Chaos struct {
+	Seed    uint64        // Seeds every random choice, so a failing run can be replayed with the same seed
+	Delay   time.Duration // Holds each message back for a random time up to Delay before offering it
+	Reorder int           // Lets each message overtake, or be overtaken by, up to Reorder others
+	Drop    float64       // Probability of dropping each message as it arrives, as a full buffer would
+}
+
+// chaos injects the faults of WithChaos, drawing every random choice from one seeded source.
+type chaos struct {
+	Chaos
+	rand *rand.Rand
+
+	due    time.Duration // When the head may be offered, since the buffer started
+	picked bool          // Whether due was picked for the current head
+}
+
+func newChaos(c Chaos) *chaos {
+	return &chaos{Chaos: c, rand: rand.New(rand.NewPCG(c.Seed, c.Seed))}
+}
+
+// drop reports whether to drop the message arriving next.
+func (c *chaos) drop() bool {
+	return c.Drop > 0 && c.rand.Float64() < c.Drop
+}
+
+// wait returns how long until the head may be offered at now, picking a delay for it the first time.
+func (c *chaos) wait(now time.Duration) time.Duration {
+	if c.Delay <= 0 {
+		return 0
+	}
+
+	if !c.picked {
+		c.due, c.picked = now+time.Duration(c.rand.Int64N(int64(c.Delay)+1)), true
+	}
+
+	return max(c.due-now, 0)
+}
+
+// take starts over with the next head, once the current one was delivered.
+func (c *chaos) take() {
+	c.picked = false
+}
+
+// shuffled is a store that delivers a random one of the next messages of its inner store, for WithChaos.
+// Messages are moved from the inner store to a window of up to limit+1 messages, the next one to deliver is
+// picked from it the first time the head is peeked, and stays the head until it is popped. A message that was
+// overtaken limit times is picked next, so none is held back for more than limit others.
+type shuffled[T any] struct {
+	store[elem[T]]
+	window []elem[T]
+	passed []int // How many times each message of window was overtaken
+	limit  int
+	pick   int // Index of the head in window, or -1 until picked
+	rand   *rand.Rand
+}
+
+func newShuffled[T any](inner store[elem[T]], limit int, rand *rand.Rand) *shuffled[T] {
+	return &shuffled[T]{store: inner, limit: limit, pick: -1, rand: rand}
+}
+
+func (s *shuffled[T]) len() int {
+	return len(s.window) + s.store.len()
+}
+
+func (s *shuffled[T]) peek() elem[T] {
+	if s.pick < 0 {
+		for len(s.window) <= s.limit && s.store.len() > 0 {
+			s.window = append(s.window, s.store.pop())
+			s.passed = append(s.passed, 0)
+		}
+
+		s.pick = slices.Index(s.passed, s.limit)
+		if s.pick < 0 {
+			s.pick = s.rand.IntN(len(s.window))
+		}
+	}
+
+	return s.window[s.pick]
+}
+
+func (s *shuffled[T]) pop() elem[T] {
+	e := s.peek()
+	for i := range s.pick {
+		s.passed[i]++
+	}
+
+	s.window = slices.Delete(s.window, s.pick, s.pick+1)
+	s.passed = slices.Delete(s.passed, s.pick, s.pick+1)
+	s.pick = -1
+
+	return e
+}
+
+// folds only looks at the inner store, since messages of the window were already taken from it.
+func (s *shuffled[T]) folds(e elem[T]) bool {
+	return folds(s.store, e)
+}
+
+func (s *shuffled[T]) walkable() bool {
+	return canWalk(s.store)
+}
+
+// walk goes through the head if it was picked, then the rest of the window, then the inner store. Past the
+// head, the messages of the window are delivered in an order that is only picked as they come up.
+func (s *shuffled[T]) walk(fn func(elem[T]) bool) bool {
+	if s.pick >= 0 && !fn(s.window[s.pick]) {
+		return false
+	}
+
+	for i, e := range s.window {
+		if i != s.pick && !fn(e) {
+			return false
+		}
+	}
+
+	return s.store.(walker[elem[T]]).walk(fn)
+}
+
+// close forwards to the inner store, so it still releases its resources.
+func (s *shuffled[T]) close() {
+	if c, ok := s.store.(closer); ok {
+		c.close()
+	}
+}
+
+// failure forwards to the inner store, so it still stops the buffer.
+func (s *shuffled[T]) failure() error {
+	if f, ok := s.store.(failing); ok {
+		return f.failure()
+	}
+
+	return nil
+}
+
+// retain forwards to the inner store, so it still keeps its messages.
+func (s *shuffled[T]) retain() {
+	if r, ok := s.store.(retainer); ok {
+		r.retain()
+	}
+}
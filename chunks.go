@@ -0,0 +1,159 @@
+package unboundedchannel
+
+import (
+	"reflect"
+	"sync"
+)
+
+// chunkSize is the number of messages held by each chunk of a chunkList.
+const chunkSize = 256
+
+// chunk is a fixed-size segment of a chunkList.
+type chunk[T any] struct {
+	items [chunkSize]T
+	next  *chunk[T]
+}
+
+// chunkList is a FIFO made of a linked list of fixed-size chunks.
+// Unlike a single slice, it never copies messages to grow, and it returns each chunk to a pool
+// as soon as it is consumed instead of holding memory until the whole buffer drains.
+type chunkList[T any] struct {
+	head, tail  *chunk[T]
+	first, last int // Index of the head message in head, one past the tail message in tail
+	n           int
+	pool        *sync.Pool
+
+	spare   *chunk[T]    // Consumed chunks kept back from the pool
+	held    int          // Chunks in the list plus spares
+	reserve int          // Chunks to keep held even when the list is empty
+	shrink  ShrinkPolicy // nil means return spares beyond reserve right away
+}
+
+// chunkPools holds a *sync.Pool per chunk type, shared by every buffer of that type.
+var chunkPools sync.Map
+
+// newChunkList returns an empty chunkList that keeps enough chunks for capacity messages allocated
+// for its whole lifetime, and other consumed chunks as spares until shrink says otherwise.
+func newChunkList[T any](capacity int, shrink ShrinkPolicy) *chunkList[T] {
+	t := reflect.TypeFor[chunk[T]]()
+
+	pool, ok := chunkPools.Load(t)
+	if !ok {
+		pool, _ = chunkPools.LoadOrStore(t, &sync.Pool{
+			New: func() any { return new(chunk[T]) },
+		})
+	}
+
+	l := &chunkList[T]{
+		pool:    pool.(*sync.Pool),
+		reserve: (capacity + chunkSize - 1) / chunkSize,
+		shrink:  shrink,
+	}
+
+	for ; l.held < l.reserve; l.held++ {
+		l.spare = &chunk[T]{next: l.spare}
+	}
+
+	return l
+}
+
+func (l *chunkList[T]) len() int {
+	return l.n
+}
+
+func (l *chunkList[T]) push(v T) {
+	switch {
+	case l.tail == nil:
+		l.head = l.get()
+		l.tail = l.head
+	case l.last == chunkSize:
+		c := l.get()
+		l.tail.next = c
+		l.tail = c
+		l.last = 0
+	}
+
+	l.tail.items[l.last] = v
+	l.last++
+	l.n++
+}
+
+// peek returns the head message. The list must not be empty.
+func (l *chunkList[T]) peek() T {
+	return l.head.items[l.first]
+}
+
+// pop removes and returns the head message. The list must not be empty.
+func (l *chunkList[T]) pop() T {
+	v := l.head.items[l.first]
+	l.head.items[l.first] = *new(T)
+	l.first++
+	l.n--
+
+	switch {
+	case l.n == 0:
+		// Release the last chunk everytime the list is emptied
+		l.release(l.head)
+		l.head, l.tail = nil, nil
+		l.first, l.last = 0, 0
+	case l.first == chunkSize:
+		c := l.head
+		l.head = c.next
+		l.first = 0
+		l.release(c)
+	}
+
+	return v
+}
+
+func (l *chunkList[T]) walkable() bool {
+	return true
+}
+
+// walk calls fn on each message from the head, leaving the list as it was.
+func (l *chunkList[T]) walk(fn func(T) bool) bool {
+	c, i := l.head, l.first
+	for range l.n {
+		if i == chunkSize {
+			c, i = c.next, 0
+		}
+
+		if !fn(c.items[i]) {
+			return false
+		}
+		i++
+	}
+
+	return true
+}
+
+// get returns an empty chunk, preferring a spare over the pool.
+func (l *chunkList[T]) get() *chunk[T] {
+	if c := l.spare; c != nil {
+		l.spare = c.next
+		c.next = nil
+		return c
+	}
+
+	l.held++
+	return l.pool.Get().(*chunk[T])
+}
+
+// release keeps a consumed chunk as a spare, then returns spares beyond reserve to the pool
+// if the shrink policy asks for it. Its items are already zeroed by pop.
+func (l *chunkList[T]) release(c *chunk[T]) {
+	c.next = l.spare
+	l.spare = c
+
+	if l.shrink != nil && !l.shrink(l.n, l.held*chunkSize) {
+		return
+	}
+
+	for l.held > l.reserve && l.spare != nil {
+		c := l.spare
+		l.spare = c.next
+		c.next = nil
+		l.held--
+		l.pool.Put(c)
+	}
+}
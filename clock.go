@@ -0,0 +1,82 @@
+package unboundedchannel
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time and makes the timers of every time based feature, such as WithTTL, WithIdleTimeout,
+// WithRateLimit or NewBatching, so tests can replace the system clock with a fake one, like the one of package
+// clocktest, instead of sleeping. Buffers use the clock set by WithClock, and otherwise the one of their
+// context, set by ContextWithClock, which is also the only way to reach functions that take no options.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer made by a Clock, which behaves like a time.Timer: after Reset or Stop returns, C delivers
+// no value from before.
+type Timer interface {
+	C() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// SystemClock is the Clock of package time, used unless another one is set.
+//
+// Buffers and helpers only arm timers while a feature needs one, such as a message waiting for its TTL or a
+// batch for maxWait, and stop them once there is nothing to wait for, so with SystemClock they also run
+// deterministically in testing/synctest bubbles, where time only moves once every goroutine is blocked.
+// Buffers of one bubble must not share a Budget with those of another, since they would wait on each other.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{t: time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t systemTimer) Reset(d time.Duration) bool {
+	return t.t.Reset(d)
+}
+
+func (t systemTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+type clockKey struct{}
+
+// ContextWithClock returns a copy of ctx carrying c, which buffers and helpers started with it use instead of
+// SystemClock.
+func ContextWithClock(ctx context.Context, c Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, c)
+}
+
+// clockFrom returns the clock carried by ctx, or SystemClock.
+func clockFrom(ctx context.Context) Clock {
+	if c, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return c
+	}
+
+	return SystemClock
+}
+
+// stoppedTimer returns a timer of c that isn't running, for loops that arm it as needed.
+func stoppedTimer(c Clock) Timer {
+	t := c.NewTimer(time.Hour)
+	t.Stop()
+
+	return t
+}
@@ -0,0 +1,173 @@
+// Package clocktest provides a fake unboundedchannel.Clock, so tests of time based features such as TTLs,
+// batching by time, idle timeouts or rate limits run instantly and deterministically instead of sleeping.
+//
+// Set the clock on a buffer with WithClock, or on a context with ContextWithClock, wait for the buffering
+// goroutine to arm its timers with WaitTimers, then move time with Advance:
+//
+//	clock := clocktest.New(time.Now())
+//	in, out := unboundedchannel.NewBatching[int](unboundedchannel.ContextWithClock(ctx, clock), 10, time.Second)
+//	in <- 1
+//	clock.WaitTimers(ctx, 1)
+//	clock.Advance(time.Second) // out now offers []int{1}
+//
+// Tests that can use testing/synctest don't need a fake clock: SystemClock already follows the bubble's time.
+package clocktest
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/launch-lab-public/unboundedchannel"
+)
+
+// Clock is a fake clock whose time only moves with Advance and Set, which fire the timers that become due.
+// It is safe for concurrent use.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*timer      // Armed timers
+	changed chan struct{} // Closed and replaced whenever a timer is armed, for WaitTimers
+}
+
+// New returns a Clock that starts at start.
+func New(start time.Time) *Clock {
+	return &Clock{now: start, changed: make(chan struct{})}
+}
+
+// Now returns the clock's current time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTimer returns a timer that fires once the clock reached d from now.
+func (c *Clock) NewTimer(d time.Duration) unboundedchannel.Timer {
+	t := &timer{clock: c, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+
+	return t
+}
+
+// Advance moves the clock d forward, firing the timers that become due.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	c.fire()
+}
+
+// Set moves the clock to t, firing the timers that become due. Moving it backwards fires nothing.
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = t
+	c.fire()
+}
+
+// Timers returns the number of timers armed and not yet fired.
+func (c *Clock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+// WaitTimers waits until at least n timers are armed, so time is only advanced once the goroutines under test
+// wait for it. It returns ctx.Err() if ctx is done first.
+func (c *Clock) WaitTimers(ctx context.Context, n int) error {
+	for {
+		c.mu.Lock()
+		armed, changed := len(c.timers), c.changed
+		c.mu.Unlock()
+
+		if armed >= n {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// fire sends the current time on the timers that are due, earliest first, and disarms them.
+func (c *Clock) fire() {
+	slices.SortStableFunc(c.timers, func(a, b *timer) int {
+		return a.when.Compare(b.when)
+	})
+
+	for len(c.timers) > 0 && !c.timers[0].when.After(c.now) {
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+
+		select {
+		case t.ch <- t.when:
+		default:
+		}
+	}
+}
+
+// remove disarms t, reporting whether it was armed.
+func (c *Clock) remove(t *timer) bool {
+	i := slices.Index(c.timers, t)
+	if i < 0 {
+		return false
+	}
+
+	c.timers = slices.Delete(c.timers, i, i+1)
+	return true
+}
+
+type timer struct {
+	clock *Clock
+	ch    chan time.Time
+	when  time.Time
+}
+
+func (t *timer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *timer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	armed := c.remove(t)
+	t.drain()
+
+	t.when = c.now.Add(d)
+	c.timers = append(c.timers, t)
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.fire()
+
+	return armed
+}
+
+func (t *timer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	armed := c.remove(t)
+	t.drain()
+
+	return armed
+}
+
+// drain discards a value sent before Reset or Stop, as a time.Timer does.
+func (t *timer) drain() {
+	select {
+	case <-t.ch:
+	default:
+	}
+}
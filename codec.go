@@ -0,0 +1,52 @@
+package unboundedchannel
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec converts messages to and from bytes, for features that keep them outside of memory, such as WithSpill
+// and NewDurableQueue. JSONCodec and GobCodec cover the standard library; other formats, such as protocol
+// buffers, only need a type with these two methods.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec is a Codec encoding messages as JSON with encoding/json, so only their exported fields are kept.
+type JSONCodec[T any] struct{}
+
+// Encode returns v as JSON.
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Decode returns the message encoded as JSON in data.
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+
+	return v, err
+}
+
+// GobCodec is a Codec encoding messages with encoding/gob. Each message is encoded on its own, along with the
+// description of its type, so it takes more room than in a single gob stream.
+// Interface values must have their concrete types registered with gob.Register.
+type GobCodec[T any] struct{}
+
+// Encode returns v encoded with gob.
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&v)
+
+	return buf.Bytes(), err
+}
+
+// Decode returns the message encoded with gob in data.
+func (GobCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+
+	return v, err
+}
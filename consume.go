@@ -0,0 +1,144 @@
+package unboundedchannel
+
+import (
+	"cmp"
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Consume reads messages from out with a pool of workers goroutines, calling fn for each one, until out is
+// closed or ctx is done. The context passed to fn is cancelled as soon as any call returns an error, after
+// which the workers stop taking messages. Consume waits for every call to return, and returns the first
+// error, or ctx.Err() if ctx was done first, or nil once out is closed and drained.
+// Consume panics if workers is less than 1.
+func Consume[T any](ctx context.Context, out <-chan T, workers int, fn func(context.Context, T) error) error {
+	if workers < 1 {
+		panic("unboundedchannel: Consume workers must be positive")
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for ctx.Err() == nil {
+				select {
+				case v, ok := <-out:
+					if !ok {
+						return
+					}
+
+					if err := fn(ctx, v); err != nil {
+						cancel(err)
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return context.Cause(ctx)
+}
+
+// Collect reads every message from out into a slice until it is closed. If ctx is done first, Collect returns
+// the messages read so far along with ctx.Err().
+func Collect[T any](ctx context.Context, out <-chan T) ([]T, error) {
+	var s []T
+
+	for {
+		select {
+		case v, ok := <-out:
+			if !ok {
+				return s, nil
+			}
+
+			s = append(s, v)
+		case <-ctx.Done():
+			return s, ctx.Err()
+		}
+	}
+}
+
+// Backoff sets how ConsumeWithRetry retries a failing call: after the nth failure it waits Initial doubled n-1
+// times, capped at Max, and randomly shortened by up to half so retries of many messages spread out.
+type Backoff struct {
+	Initial  time.Duration // Wait after the first failure, 100ms if zero
+	Max      time.Duration // Longest wait, 30s if zero
+	Attempts int           // Calls per message, the first one included, 3 if zero
+}
+
+// delay returns how long to wait after the nth failure of a message.
+func (b Backoff) delay(n int) time.Duration {
+	d, limit := cmp.Or(b.Initial, 100*time.Millisecond), cmp.Or(b.Max, 30*time.Second)
+	for ; n > 1 && d < limit; n-- {
+		d *= 2
+	}
+	d = min(d, limit)
+
+	return d - rand.N(d/2+1)
+}
+
+// ConsumeWithRetry reads messages from out until it is closed or ctx is done, calling fn for each one, and
+// calls fn again after a pause set by backoff as long as it returns an error, up to backoff.Attempts times.
+// A message that still fails is passed to dead along with the last error, and ConsumeWithRetry goes on with
+// the next one; with a nil dead, ConsumeWithRetry returns the error instead. It returns ctx.Err() if ctx is
+// done first, and nil once out is closed and drained.
+func ConsumeWithRetry[T any](ctx context.Context, out <-chan T, fn func(context.Context, T) error, backoff Backoff, dead func(v T, err error)) error {
+	attempts := cmp.Or(backoff.Attempts, 3)
+
+	var timer Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		var v T
+		select {
+		case m, ok := <-out:
+			if !ok {
+				return nil
+			}
+
+			v = m
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		err := fn(ctx, v)
+		for n := 1; err != nil && n < attempts; n++ {
+			if timer == nil {
+				timer = clockFrom(ctx).NewTimer(backoff.delay(n))
+			} else {
+				timer.Reset(backoff.delay(n))
+			}
+
+			select {
+			case <-timer.C():
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			err = fn(ctx, v)
+		}
+
+		if err != nil {
+			if dead == nil {
+				return err
+			}
+
+			dead(v, err)
+		}
+	}
+}
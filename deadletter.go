@@ -0,0 +1,47 @@
+package unboundedchannel
+
+import "strconv"
+
+// DeadReason tells why a message passed to WithDeadLetter was thrown away.
+type DeadReason int
+
+const (
+	// DeadDropped is a message discarded by the overflow policy of a full buffer.
+	DeadDropped DeadReason = iota
+
+	// DeadExpired is a message that outlived WithTTL.
+	DeadExpired
+
+	// DeadExhausted is a message whose delivery failed as many times as WithMaxAttempts allows.
+	DeadExhausted
+
+	// DeadUndelivered is a message still buffered, or not yet acknowledged, when the buffer stopped early
+	// because its context is done or the queue is discarded.
+	DeadUndelivered
+)
+
+// String returns the name of the reason.
+func (r DeadReason) String() string {
+	switch r {
+	case DeadDropped:
+		return "DeadDropped"
+	case DeadExpired:
+		return "DeadExpired"
+	case DeadExhausted:
+		return "DeadExhausted"
+	case DeadUndelivered:
+		return "DeadUndelivered"
+	default:
+		return "DeadReason(" + strconv.Itoa(int(r)) + ")"
+	}
+}
+
+// WithDeadLetter calls fn from the buffering goroutine with every message the buffer throws away instead of
+// delivering, and why, so they can be inspected or kept elsewhere. fn runs alongside WithOnDrop, WithOnExpire
+// and WithMaxAttempts, and must not block; writing to the in channel of another unbounded buffer is a way to
+// collect them on a channel. The element type of fn must match the buffer's, or the constructor panics.
+func WithDeadLetter[T any](fn func(v T, reason DeadReason)) Option {
+	return func(o *options) {
+		o.deadLetter = fn
+	}
+}
@@ -0,0 +1,60 @@
+package unboundedchannel
+
+import (
+	"context"
+	"fmt"
+)
+
+// KeyedOut is an output channel of Demux, carrying every message with the given key.
+type KeyedOut[T any, K comparable] struct {
+	Key K
+	Out <-chan T
+}
+
+// Demux returns an input channel and a channel of per-key outputs: each message written to in is routed by
+// key to the output for that key, which is created and announced on outs the first time the key is seen.
+// Messages with the same key keep their order, which lets sharded consumers process each key sequentially.
+// Every output, including outs, is buffered like NewWithContext, and opts configure the per-key outputs, whose
+// names set by WithName and WithExpvar get the key appended, as in name/key.
+// With a blocking option such as WithCapacity, a full output holds up routing for every key.
+// Closing in closes every output once it drains; outs is closed once every output has been announced.
+func Demux[T any, K comparable](ctx context.Context, key func(T) K, opts ...Option) (in chan<- T, outs <-chan KeyedOut[T, K]) {
+	src := start[T](ctx, nil)
+	announce := start[KeyedOut[T, K]](ctx, nil)
+
+	// Route messages to their key's buffer
+	go func() {
+		defer close(announce.in)
+
+		bufs := make(map[K]*buffer[T, T])
+		defer func() {
+			for _, b := range bufs {
+				close(b.in)
+			}
+		}()
+
+		for v := range src.out {
+			k := key(v)
+
+			b, ok := bufs[k]
+			if !ok {
+				b = start[T](ctx, append(opts[:len(opts):len(opts)], withSuffix("/"+fmt.Sprint(k))))
+				bufs[k] = b
+
+				select {
+				case announce.in <- KeyedOut[T, K]{Key: k, Out: b.out}:
+				case <-announce.done:
+					return
+				}
+			}
+
+			select {
+			case b.in <- v:
+			case <-b.done:
+				return
+			}
+		}
+	}()
+
+	return src.in, announce.out
+}
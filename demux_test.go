@@ -0,0 +1,37 @@
+package unboundedchannel
+
+import (
+	"context"
+	"expvar"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestDemuxNamesPerKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Published variables can't be removed, so every run needs names of its own
+	prefix := "test.demux." + strconv.FormatUint(expvarRuns.Add(1), 10)
+	r := NewRegistry()
+	in, outs := Demux(ctx, func(v int) int { return v % 2 }, WithExpvar(prefix),
+		WithName("demux"), WithRegistry(r))
+	in <- 1
+	in <- 2
+
+	for range 2 {
+		o := <-outs
+		<-o.Out
+	}
+
+	for _, name := range []string{prefix + "/0", prefix + "/1"} {
+		if expvar.Get(name) == nil {
+			t.Errorf("%s not published", name)
+		}
+	}
+
+	if got := r.Names(); !slices.Equal(got, []string{"demux/0", "demux/1"}) {
+		t.Errorf("registry lists %v", got)
+	}
+}
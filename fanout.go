@@ -0,0 +1,41 @@
+package unboundedchannel
+
+import "context"
+
+// Distribution selects how NewFanOut spreads messages across its outputs.
+type Distribution int
+
+const (
+	// RoundRobin delivers each message to the next output in turn, waiting for that output's worker even
+	// if others are idle. Every worker sees the same share of messages.
+	RoundRobin Distribution = iota
+
+	// LeastLoaded delivers each message to whichever worker is ready to receive first.
+	LeastLoaded
+)
+
+// NewFanOut returns an input channel and n output channels, buffered like NewWithOptions, that spread
+// messages across a pool of n workers without a separate dispatcher goroutine.
+// With LeastLoaded all the outputs are the same channel, since a channel shared by the workers already hands
+// each message to an idle one. Every output is closed once in is closed and the buffer drains, or ctx is done.
+// NewFanOut panics if n is less than 1.
+func NewFanOut[T any](ctx context.Context, n int, dist Distribution, opts ...Option) (chan<- T, []<-chan T) {
+	if n < 1 {
+		panic("unboundedchannel: NewFanOut n must be positive")
+	}
+
+	if dist == RoundRobin {
+		opts = append(opts[:len(opts):len(opts)], func(o *options) {
+			o.roundRobin = n
+		})
+	}
+
+	b := start[T](ctx, opts)
+
+	outs := make([]<-chan T, n)
+	for i := range outs {
+		outs[i] = b.outs[i%len(b.outs)]
+	}
+
+	return b.in, outs
+}
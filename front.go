@@ -0,0 +1,87 @@
+package unboundedchannel
+
+// fronted is a store that also takes messages at its front, for WithRequeueFront. They are delivered before
+// those of the inner store, most recently requeued first.
+type fronted[T any] struct {
+	store[elem[T]]
+	front   *stack[elem[T]]
+	weights *weighed[T] // Charged for the messages at the front, if WithSizer is set
+}
+
+func newFronted[T any](inner store[elem[T]], weights *weighed[T]) *fronted[T] {
+	return &fronted[T]{store: inner, front: newStack[elem[T]](0, nil), weights: weights}
+}
+
+func (s *fronted[T]) len() int {
+	return s.front.len() + s.store.len()
+}
+
+func (s *fronted[T]) pushFront(e elem[T]) {
+	s.front.push(e)
+	if s.weights != nil {
+		s.weights.add(s.weights.size(e.v))
+	}
+}
+
+func (s *fronted[T]) peek() elem[T] {
+	if s.front.len() > 0 {
+		return s.front.peek()
+	}
+
+	return s.store.peek()
+}
+
+func (s *fronted[T]) pop() elem[T] {
+	if s.front.len() == 0 {
+		return s.store.pop()
+	}
+
+	e := s.front.pop()
+	if s.weights != nil {
+		s.weights.add(-s.weights.size(e.v))
+	}
+
+	return e
+}
+
+// folds only looks at the inner store, since messages at the front were already taken from it.
+func (s *fronted[T]) folds(e elem[T]) bool {
+	return folds(s.store, e)
+}
+
+func (s *fronted[T]) walkable() bool {
+	return canWalk(s.store)
+}
+
+// walk goes through the messages at the front, most recently requeued first, then those of the inner store.
+func (s *fronted[T]) walk(fn func(elem[T]) bool) bool {
+	for i := len(s.front.items) - 1; i >= 0; i-- {
+		if !fn(s.front.items[i]) {
+			return false
+		}
+	}
+
+	return s.store.(walker[elem[T]]).walk(fn)
+}
+
+// close, failure and retain forward to the inner store.
+
+func (s *fronted[T]) close() {
+	if c, ok := s.store.(closer); ok {
+		c.close()
+	}
+}
+
+func (s *fronted[T]) failure() error {
+	if f, ok := s.store.(failing); ok {
+		return f.failure()
+	}
+
+	return nil
+}
+
+func (s *fronted[T]) retain() {
+	if r, ok := s.store.(retainer); ok {
+		r.retain()
+	}
+}
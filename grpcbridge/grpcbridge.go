@@ -0,0 +1,218 @@
+// Package grpcbridge carries the messages of unboundedchannel buffers across processes over gRPC, encoded
+// with an unboundedchannel.Codec, so in-process buffers can be chained into cross-process pipelines.
+//
+// A Server exposes a buffer's output as a server-streaming Subscribe method, and feeds a buffer's input from
+// a client-streaming Publish method. Messages travel as google.protobuf.BytesValue, so no generated code is
+// needed on either side:
+//
+//	srv := grpcbridge.NewServer(unboundedchannel.JSONCodec[Job]{}, out, in)
+//	srv.Register(grpcServer)
+//
+// A client reads from a Server with Subscribe, and writes to it with Publish:
+//
+//	err := grpcbridge.Subscribe(ctx, conn, unboundedchannel.JSONCodec[Job]{}, localIn)
+package grpcbridge
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/launch-lab-public/unboundedchannel"
+)
+
+// ServiceName is the name of the gRPC service a Server registers.
+const ServiceName = "unboundedchannel.bridge.v1.Bridge"
+
+const (
+	subscribeMethod = "/" + ServiceName + "/Subscribe"
+	publishMethod   = "/" + ServiceName + "/Publish"
+)
+
+var (
+	subscribeDesc = grpc.StreamDesc{StreamName: "Subscribe", ServerStreams: true}
+	publishDesc   = grpc.StreamDesc{StreamName: "Publish", ClientStreams: true}
+)
+
+// Server serves the messages of one buffer over gRPC.
+type Server[T any] struct {
+	codec unboundedchannel.Codec[T]
+	out   <-chan T
+	in    chan<- T
+}
+
+// NewServer returns a Server that sends the messages read from out to Subscribe clients, and writes the
+// messages of Publish clients to in. Either may be nil, and the corresponding method then fails with
+// codes.Unimplemented.
+func NewServer[T any](codec unboundedchannel.Codec[T], out <-chan T, in chan<- T) *Server[T] {
+	return &Server[T]{codec: codec, out: out, in: in}
+}
+
+// Register registers the Bridge service on r.
+func (s *Server[T]) Register(r grpc.ServiceRegistrar) {
+	subscribe, publish := subscribeDesc, publishDesc
+	subscribe.Handler = func(_ any, stream grpc.ServerStream) error {
+		return s.subscribe(stream)
+	}
+	publish.Handler = func(_ any, stream grpc.ServerStream) error {
+		return s.publish(stream)
+	}
+
+	r.RegisterService(&grpc.ServiceDesc{
+		ServiceName: ServiceName,
+		HandlerType: (*any)(nil),
+		Streams:     []grpc.StreamDesc{subscribe, publish},
+	}, s)
+}
+
+// subscribe sends messages from out until it is closed or the client goes away. Subscribers share out, so
+// each message goes to one of them; a message taken from out is lost if sending it fails.
+func (s *Server[T]) subscribe(stream grpc.ServerStream) error {
+	if s.out == nil {
+		return status.Error(codes.Unimplemented, "grpcbridge: Subscribe is not served")
+	}
+
+	if err := stream.RecvMsg(new(emptypb.Empty)); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	for {
+		select {
+		case v, ok := <-s.out:
+			if !ok {
+				return nil
+			}
+
+			data, err := s.codec.Encode(v)
+			if err != nil {
+				return status.Errorf(codes.Internal, "grpcbridge: encoding message: %v", err)
+			}
+
+			if err := stream.SendMsg(wrapperspb.Bytes(data)); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// publish writes the messages of a client to in until it closes its side of the stream.
+func (s *Server[T]) publish(stream grpc.ServerStream) error {
+	if s.in == nil {
+		return status.Error(codes.Unimplemented, "grpcbridge: Publish is not served")
+	}
+
+	ctx := stream.Context()
+	for {
+		msg := new(wrapperspb.BytesValue)
+		if err := stream.RecvMsg(msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return stream.SendMsg(new(emptypb.Empty))
+			}
+
+			return err
+		}
+
+		v, err := s.codec.Decode(msg.GetValue())
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "grpcbridge: decoding message: %v", err)
+		}
+
+		select {
+		case s.in <- v:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// Subscribe reads the messages of a Server over conn and writes them to in, until the server's buffer is
+// closed and drained, in which case it returns nil, or the stream fails or ctx is done. It doesn't close in.
+func Subscribe[T any](ctx context.Context, conn grpc.ClientConnInterface, codec unboundedchannel.Codec[T], in chan<- T) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := conn.NewStream(ctx, &subscribeDesc, subscribeMethod)
+	if err != nil {
+		return err
+	}
+
+	if err := stream.SendMsg(new(emptypb.Empty)); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		msg := new(wrapperspb.BytesValue)
+		if err := stream.RecvMsg(msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		v, err := codec.Decode(msg.GetValue())
+		if err != nil {
+			return err
+		}
+
+		select {
+		case in <- v:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Publish sends the messages read from out to a Server over conn, until out is closed, in which case it
+// waits for the server to accept the last of them and returns nil, or the stream fails or ctx is done.
+// A message taken from out is lost if sending it fails.
+func Publish[T any](ctx context.Context, conn grpc.ClientConnInterface, codec unboundedchannel.Codec[T], out <-chan T) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := conn.NewStream(ctx, &publishDesc, publishMethod)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case v, ok := <-out:
+			if !ok {
+				if err := stream.CloseSend(); err != nil {
+					return err
+				}
+
+				return stream.RecvMsg(new(emptypb.Empty))
+			}
+
+			data, err := codec.Encode(v)
+			if err != nil {
+				return err
+			}
+
+			// A failed send is reported by RecvMsg
+			if err := stream.SendMsg(wrapperspb.Bytes(data)); err != nil {
+				if errors.Is(err, io.EOF) {
+					return stream.RecvMsg(new(emptypb.Empty))
+				}
+
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
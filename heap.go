@@ -0,0 +1,103 @@
+package unboundedchannel
+
+// heapItem is a message in a priorityHeap, with its arrival order to break ties.
+type heapItem[T any] struct {
+	v   T
+	seq uint64
+}
+
+// priorityHeap is a binary min-heap ordered by less. Messages of equal priority keep their FIFO order.
+// Like ring, it keeps the largest size it has reached unless a ShrinkPolicy says otherwise.
+type priorityHeap[T any] struct {
+	items []heapItem[T]
+	less  func(a, b T) bool
+	seq   uint64
+
+	floor  int
+	shrink ShrinkPolicy
+}
+
+func newPriorityHeap[T any](less func(a, b T) bool, capacity int, shrink ShrinkPolicy) *priorityHeap[T] {
+	return &priorityHeap[T]{
+		items:  make([]heapItem[T], 0, capacity),
+		less:   less,
+		floor:  capacity,
+		shrink: shrink,
+	}
+}
+
+func (h *priorityHeap[T]) len() int {
+	return len(h.items)
+}
+
+func (h *priorityHeap[T]) push(v T) {
+	h.items = append(h.items, heapItem[T]{v: v, seq: h.seq})
+	h.seq++
+	h.up(len(h.items) - 1)
+}
+
+// peek returns the message with the highest priority. The heap must not be empty.
+func (h *priorityHeap[T]) peek() T {
+	return h.items[0].v
+}
+
+// pop removes and returns the message with the highest priority. The heap must not be empty.
+func (h *priorityHeap[T]) pop() T {
+	v := h.items[0].v
+	n := len(h.items) - 1
+	h.items[0] = h.items[n]
+	h.items[n] = heapItem[T]{}
+	h.items = h.items[:n]
+	if n > 0 {
+		h.down(0)
+	}
+
+	if h.shrink != nil && cap(h.items) > h.floor && h.shrink(n, cap(h.items)) {
+		items := make([]heapItem[T], n, max(n, h.floor))
+		copy(items, h.items)
+		h.items = items
+	}
+
+	return v
+}
+
+// before reports whether the message at i must be delivered before the one at j.
+func (h *priorityHeap[T]) before(i, j int) bool {
+	a, b := &h.items[i], &h.items[j]
+	if h.less(a.v, b.v) {
+		return true
+	}
+	if h.less(b.v, a.v) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+func (h *priorityHeap[T]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.before(i, parent) {
+			break
+		}
+		h.items[i], h.items[parent] = h.items[parent], h.items[i]
+		i = parent
+	}
+}
+
+func (h *priorityHeap[T]) down(i int) {
+	n := len(h.items)
+	for {
+		first := i
+		if l := 2*i + 1; l < n && h.before(l, first) {
+			first = l
+		}
+		if r := 2*i + 2; r < n && h.before(r, first) {
+			first = r
+		}
+		if first == i {
+			return
+		}
+		h.items[i], h.items[first] = h.items[first], h.items[i]
+		i = first
+	}
+}
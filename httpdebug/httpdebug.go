@@ -0,0 +1,99 @@
+// Package httpdebug serves the statistics of the buffers listed in an unboundedchannel.Registry over HTTP,
+// for operators to see which queues back up.
+//
+// Like net/http/pprof, importing the package for its side effect registers a handler for
+// unboundedchannel.DefaultRegistry on http.DefaultServeMux, at /debug/queues:
+//
+//	import _ "github.com/launch-lab-public/unboundedchannel/httpdebug"
+//
+// Other registries or muxes use Handler:
+//
+//	mux.Handle("/debug/queues", httpdebug.Handler(registry))
+//
+// The handler renders a plain text table, or JSON with ?format=json.
+package httpdebug
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"github.com/launch-lab-public/unboundedchannel"
+)
+
+func init() {
+	http.Handle("/debug/queues", Handler(nil))
+}
+
+// Queue is the state of a buffer as rendered by the handler.
+type Queue struct {
+	Name string
+	unboundedchannel.Stats
+
+	// Messages per second over the window of WithRates, or nil if the buffer doesn't track them
+	InRate  *float64
+	OutRate *float64
+}
+
+// Handler returns a handler that renders the depth, rates, drops and age of the head of each live buffer in
+// r, or in unboundedchannel.DefaultRegistry if r is nil. Rates are only known for buffers set up with
+// unboundedchannel.WithRates, and rendered as "-" otherwise.
+func Handler(r *unboundedchannel.Registry) http.Handler {
+	if r == nil {
+		r = unboundedchannel.DefaultRegistry
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		queues := collect(r)
+
+		if req.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(queues)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "name\tlen\tcap\tmax len\tin/s\tout/s\tdropped\texpired\thead age\tclosed\t")
+		for _, q := range queues {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\t%d\t%d\t%v\t%t\t\n", q.Name, q.Len, q.Cap, q.MaxLen,
+				rate(q.InRate), rate(q.OutRate), q.Dropped, q.Expired, q.HeadAge.Round(time.Millisecond), q.Closed)
+		}
+		tw.Flush()
+	})
+}
+
+// collect reads the statistics of every live buffer in r, sorted by name.
+func collect(r *unboundedchannel.Registry) []Queue {
+	names := r.Names()
+	queues := make([]Queue, 0, len(names))
+
+	for _, name := range names {
+		stats, ok := r.Stats(name)
+		if !ok {
+			continue // Stopped since
+		}
+
+		// Lifetime averages would hide a consumer that stalled recently, so only the rolling rates are shown
+		q := Queue{Name: name, Stats: stats}
+		if stats.Rates.Window > 0 {
+			q.InRate, q.OutRate = &stats.Rates.In, &stats.Rates.Out
+		}
+
+		queues = append(queues, q)
+	}
+
+	return queues
+}
+
+// rate formats a rate for the table, or "-" if it is unknown.
+func rate(r *float64) string {
+	if r == nil {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.1f", *r)
+}
@@ -0,0 +1,65 @@
+package unboundedchannel
+
+import (
+	"context"
+	"iter"
+	"slices"
+)
+
+// Seq returns an iterator over the messages read from out, until it is closed.
+func Seq[T any](out <-chan T) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for v := range out {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// NewSeq is like NewWithOptions, except that it returns the output as an iterator.
+// The iterator ends once in is closed and the buffer drained, or ctx is done. Breaking out of a range loop
+// over it leaves the buffer as it is, so it can be ranged over again to resume.
+func NewSeq[T any](ctx context.Context, opts ...Option) (chan<- T, iter.Seq[T]) {
+	in, out := NewWithOptions[T](ctx, opts...)
+	return in, Seq(out)
+}
+
+// All returns an iterator over the messages popped from the queue, until it is closed and drained or ctx is
+// done. Breaking out of a range loop over it leaves the remaining messages in the queue.
+func (q *Queue[T]) All(ctx context.Context) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for {
+			v, ok := q.Pop(ctx)
+			if !ok || !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// FromSeq returns the output of a buffer configured by opts, fed with the values of seq by a goroutine that
+// closes the input once seq is exhausted. The goroutine stops early once ctx is done.
+func FromSeq[T any](ctx context.Context, seq iter.Seq[T], opts ...Option) <-chan T {
+	in, out := NewWithOptions[T](ctx, opts...)
+
+	go func() {
+		defer close(in)
+
+		for v := range seq {
+			select {
+			case in <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// FromSlice is like FromSeq with the elements of s. s is read as it is fed, so it must not be modified until
+// out is closed.
+func FromSlice[T any](ctx context.Context, s []T, opts ...Option) <-chan T {
+	return FromSeq(ctx, slices.Values(s), opts...)
+}
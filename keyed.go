@@ -0,0 +1,66 @@
+package unboundedchannel
+
+// keyed is a FIFO of keys where each key holds a single pending message.
+// Pushing a message whose key is already pending merges it into that message in place, so it keeps the
+// position of the first message with its key and the store never holds more messages than there are
+// distinct keys.
+type keyed[T any, K comparable] struct {
+	key     func(T) K
+	merge   func(old, new T) T // nil means the new message replaces the old one
+	order   *chunkList[K]
+	pending map[K]T
+	onFold  func(old, combined T) // Set by weighed
+}
+
+func newKeyed[T any, K comparable](key func(T) K, merge func(old, new T) T, capacity int, shrink ShrinkPolicy) *keyed[T, K] {
+	return &keyed[T, K]{
+		key:     key,
+		merge:   merge,
+		order:   newChunkList[K](capacity, shrink),
+		pending: make(map[K]T, capacity),
+	}
+}
+
+func (s *keyed[T, K]) len() int {
+	return s.order.len()
+}
+
+func (s *keyed[T, K]) push(v T) {
+	k := s.key(v)
+	old, ok := s.pending[k]
+	switch {
+	case !ok:
+		s.order.push(k)
+	case s.merge != nil:
+		v = s.merge(old, v)
+	}
+
+	s.pending[k] = v
+
+	if ok && s.onFold != nil {
+		s.onFold(old, v)
+	}
+}
+
+func (s *keyed[T, K]) folds(v T) bool {
+	_, ok := s.pending[s.key(v)]
+	return ok
+}
+
+func (s *keyed[T, K]) setOnFold(fn func(old, combined T)) {
+	s.onFold = fn
+}
+
+// peek returns the message of the oldest pending key. The store must not be empty.
+func (s *keyed[T, K]) peek() T {
+	return s.pending[s.order.peek()]
+}
+
+// pop removes and returns the message of the oldest pending key. The store must not be empty.
+func (s *keyed[T, K]) pop() T {
+	k := s.order.pop()
+	v := s.pending[k]
+	delete(s.pending, k)
+
+	return v
+}
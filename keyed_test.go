@@ -0,0 +1,41 @@
+package unboundedchannel
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestConflateAtCapacity(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow OverflowPolicy
+	}{
+		{"DropOldest", DropOldest},
+		{"DropNewest", DropNewest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQueue[int](context.Background(), WithConflate(func(v int) int { return v % 2 }),
+				WithCapacity(2), WithOverflow(tt.overflow))
+			defer q.Discard()
+
+			// 3 replaces the pending 1, so the queue stays at capacity without dropping 2
+			q.Pause()
+			for _, v := range []int{1, 2, 3} {
+				q.Push(context.Background(), v)
+			}
+
+			got, _ := q.Snapshot()
+			if !slices.Equal(got, []int{3, 2}) {
+				t.Errorf("buffered %v, want [3 2]", got)
+			}
+
+			stats := q.Stats()
+			if stats.Dropped != 0 || stats.Duplicates != 1 {
+				t.Errorf("dropped %d and duplicates %d, want 0 and 1", stats.Dropped, stats.Duplicates)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package unboundedchannel
+
+import (
+	"context"
+	"sync"
+)
+
+// laned is a message tagged with the index of the lane it was written to.
+type laned[T any] struct {
+	lane int
+	v    T
+}
+
+// NewLanes returns n input channels of descending priority feeding one output channel, each buffered
+// like NewWithContext. Messages are delivered in strict priority order: out only delivers a message from
+// ins[i] when the lanes before it have nothing buffered. Within a lane, messages stay FIFO.
+// The caller must close every input, or cancel ctx, to eventually close out.
+// NewLanes panics if n is less than 1.
+func NewLanes[T any](ctx context.Context, n int) (ins []chan<- T, out <-chan T) {
+	if n < 1 {
+		panic("unboundedchannel: NewLanes n must be positive")
+	}
+
+	return startLanes[T](ctx, make([]int, n))
+}
+
+// NewWeightedLanes is like NewLanes with one lane per weight, except that lanes share out by weight instead
+// of strictly: while several lanes have messages buffered, lane i gets weights[i] deliveries per round.
+// Lower priority lanes are therefore never starved by a busy urgent lane.
+// NewWeightedLanes panics if no weights are given or any weight is less than 1.
+func NewWeightedLanes[T any](ctx context.Context, weights ...int) (ins []chan<- T, out <-chan T) {
+	if len(weights) == 0 {
+		panic("unboundedchannel: NewWeightedLanes needs at least one weight")
+	}
+
+	for _, w := range weights {
+		if w < 1 {
+			panic("unboundedchannel: NewWeightedLanes weights must be positive")
+		}
+	}
+
+	return startLanes[T](ctx, weights)
+}
+
+// startLanes starts a lane for each weight, where all-zero weights mean strict priority.
+func startLanes[T any](ctx context.Context, weights []int) ([]chan<- T, <-chan T) {
+	ins := make([]chan<- T, len(weights))
+	merged := make(chan laned[T])
+	out := make(chan T)
+
+	// Tag each lane's messages on the way into the shared buffer
+	var wg sync.WaitGroup
+	for i := range ins {
+		in := make(chan T)
+		ins[i] = in
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for t := range in {
+				select {
+				case merged <- laned[T]{lane: i, v: t}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	// Start buffering
+	go bufferLanes(ctx, merged, out, weights)
+
+	return ins, out
+}
+
+func bufferLanes[T any](ctx context.Context, in <-chan laned[T], out chan<- T, weights []int) {
+	defer close(out)
+
+	lanes := make([]*chunkList[T], len(weights))
+	for i := range lanes {
+		lanes[i] = newChunkList[T](0, nil)
+	}
+
+	credits := make([]int, len(weights))
+	copy(credits, weights)
+
+	for {
+		// Pick the lane to offer from: the most urgent one with messages, and credit left if weighted
+		next := -1
+		for pass := 0; pass < 2 && next < 0; pass++ {
+			for i, l := range lanes {
+				if l.len() > 0 && (weights[i] == 0 || credits[i] > 0) {
+					next = i
+					break
+				}
+			}
+
+			// Every busy lane has used its credit, start a new round
+			if next < 0 {
+				copy(credits, weights)
+			}
+		}
+
+		var send chan<- T
+		var head T
+		if next >= 0 {
+			send = out
+			head = lanes[next].peek()
+		} else if in == nil {
+			return // Intake is closed and every lane is drained
+		}
+
+		select {
+		case m, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+
+			lanes[m.lane].push(m.v)
+		case send <- head:
+			lanes[next].pop()
+			credits[next]--
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package unboundedchannel
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// Latency summarizes how long delivered messages waited in a buffer, as tracked with WithLatency.
+// Percentiles are estimated from a histogram, and are within 25% of the exact value.
+type Latency struct {
+	Count uint64 // Messages delivered since tracking started
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// Each power of two of nanoseconds is split into this many buckets
+const latencySubBits = 2
+
+// latencyHistogram counts waits in log-linear buckets, updated by the buffering goroutine and read by anyone.
+type latencyHistogram struct {
+	buckets [(64 + 1) << latencySubBits]atomic.Uint64
+	count   atomic.Uint64
+	max     atomic.Int64
+}
+
+// latencyBucket returns the index of the bucket d falls in.
+func latencyBucket(d time.Duration) int {
+	ns := uint64(max(d, 0))
+
+	// Small values have a bucket each
+	if ns < 1<<latencySubBits {
+		return int(ns)
+	}
+
+	// The leading bit selects the power of two, the ones after it the bucket within
+	e := bits.Len64(ns) - 1
+	sub := (ns >> (e - latencySubBits)) & (1<<latencySubBits - 1)
+
+	return (e-latencySubBits+1)<<latencySubBits | int(sub)
+}
+
+// latencyUpper returns the highest wait that falls in bucket i.
+func latencyUpper(i int) time.Duration {
+	if i < 1<<latencySubBits {
+		return time.Duration(i)
+	}
+
+	e := i>>latencySubBits + latencySubBits - 1
+	sub := uint64(i & (1<<latencySubBits - 1))
+	lower := (1<<latencySubBits | sub) << (e - latencySubBits)
+
+	return time.Duration(lower + 1<<(e-latencySubBits) - 1)
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	h.buckets[latencyBucket(d)].Add(1)
+	h.count.Add(1)
+
+	if int64(d) > h.max.Load() {
+		h.max.Store(int64(d))
+	}
+}
+
+// summary estimates percentiles from the buckets. Buckets may be updated concurrently, so the counts are
+// taken once and only approximately match count.
+func (h *latencyHistogram) summary() Latency {
+	var counts [len(h.buckets)]uint64
+	var total uint64
+	for i := range h.buckets {
+		counts[i] = h.buckets[i].Load()
+		total += counts[i]
+	}
+
+	l := Latency{Count: total, Max: time.Duration(h.max.Load())}
+	if total == 0 {
+		return l
+	}
+
+	// Walk the buckets once, filling each percentile as its rank is reached
+	targets := []struct {
+		q float64
+		d *time.Duration
+	}{{0.50, &l.P50}, {0.95, &l.P95}, {0.99, &l.P99}}
+
+	var seen uint64
+	for i, n := range counts {
+		seen += n
+
+		for len(targets) > 0 && float64(seen) >= targets[0].q*float64(total) {
+			*targets[0].d = min(latencyUpper(i), l.Max)
+			targets = targets[1:]
+		}
+	}
+
+	return l
+}
@@ -0,0 +1,95 @@
+package unboundedchannel
+
+import (
+	"context"
+	"time"
+)
+
+// NewDebounce returns a pair of channels (in, out) for bursty event streams, such as file change
+// notifications: out delivers the latest message written to in once no other message followed it for quiet,
+// and earlier messages of the burst are discarded. Closing in delivers the pending message right away.
+// NewDebounce panics if quiet is not positive.
+func NewDebounce[T any](ctx context.Context, quiet time.Duration) (chan<- T, <-chan T) {
+	if quiet <= 0 {
+		panic("unboundedchannel: NewDebounce quiet must be positive")
+	}
+
+	in := make(chan T)
+	out := make(chan T)
+
+	// Start buffering
+	go bufferLatest(ctx, in, out, quiet, true)
+
+	return in, out
+}
+
+// NewThrottle returns a pair of channels (in, out) that deliver at most one message per interval: a message
+// written to in is delivered right away if none was in the last interval, and otherwise waits for the
+// interval to end, replaced by any message written in the meantime so the latest one wins.
+// NewThrottle panics if interval is not positive.
+func NewThrottle[T any](ctx context.Context, interval time.Duration) (chan<- T, <-chan T) {
+	if interval <= 0 {
+		panic("unboundedchannel: NewThrottle interval must be positive")
+	}
+
+	in := make(chan T)
+	out := make(chan T)
+
+	// Start buffering
+	go bufferLatest(ctx, in, out, interval, false)
+
+	return in, out
+}
+
+// bufferLatest moves the latest message from in to out once it is due, holding a single pending message that
+// each new one replaces. With debounce, the pending message is due d after it arrived, and is delivered right
+// away once in is closed; otherwise it is due d after the previous delivery.
+func bufferLatest[T any](ctx context.Context, in <-chan T, out chan<- T, d time.Duration, debounce bool) {
+	defer close(out)
+
+	var pending T
+	var has bool
+	var due time.Time // When pending may be delivered
+
+	clock := clockFrom(ctx)
+	timer := stoppedTimer(clock)
+	defer timer.Stop()
+
+	for {
+		// Only offer the pending message to out once it is due
+		var send chan<- T
+		var wake <-chan time.Time
+		if has {
+			if wait := due.Sub(clock.Now()); wait <= 0 || (debounce && in == nil) {
+				send = out
+			} else {
+				timer.Reset(wait)
+				wake = timer.C()
+			}
+		} else if in == nil {
+			return // Intake is closed and everything was delivered
+		}
+
+		select {
+		case v, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+
+			pending, has = v, true
+			if debounce {
+				due = clock.Now().Add(d)
+			}
+		case send <- pending:
+			pending, has = *new(T), false
+			if !debounce {
+				due = clock.Now().Add(d)
+			}
+		case <-wake:
+			// The pending message is offered on the next iteration
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package unboundedchannel
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Merge returns a channel that receives every message from ins, buffered like NewWithContext.
+// Messages from the same input keep their order. The returned channel is closed once every input is closed
+// and the buffer drains, or once ctx is done.
+func Merge[T any](ctx context.Context, ins ...<-chan T) <-chan T {
+	b := start[T](ctx, nil)
+
+	var wg sync.WaitGroup
+	for _, in := range ins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case v, ok := <-in:
+					if !ok {
+						return
+					}
+
+					select {
+					case b.in <- v:
+					case <-b.done:
+						return
+					}
+				case <-b.done:
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(b.in)
+	}()
+
+	return b.out
+}
+
+// MergeOrdered returns a channel that receives every message from ins in order of key, such as event
+// streams of several partitions merged back into global order. Each input must deliver its own messages in
+// order of key. A message is delivered once every open input has a message pending, so none can come before
+// it, or once its key is lateness in the past, so an idle input doesn't hold back the others forever.
+// A message that comes later than that is delivered right away, out of order. Inputs are read as fast as
+// they deliver, buffering as much as needed. The returned channel is closed once every input is closed and
+// the buffer drains, or once ctx is done.
+func MergeOrdered[T any](ctx context.Context, key func(T) time.Time, lateness time.Duration, ins ...<-chan T) <-chan T {
+	out := make(chan T)
+	recv := make(chan tagged[T])
+
+	done := make(chan struct{})
+	for i, in := range ins {
+		go func() {
+			for {
+				var t tagged[T]
+				select {
+				case v, ok := <-in:
+					t = tagged[T]{input: i, v: v, closed: !ok}
+				case <-done:
+					return
+				}
+
+				select {
+				case recv <- t:
+				case <-done:
+					return
+				}
+
+				if t.closed {
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(out)
+		defer close(done)
+
+		mergeOrdered(ctx, recv, out, key, lateness, len(ins))
+	}()
+
+	return out
+}
+
+// tagged is a message read by MergeOrdered from one of its inputs, or the news that it was closed.
+type tagged[T any] struct {
+	input  int
+	v      T
+	closed bool
+}
+
+// mergeOrdered delivers the messages of n inputs, read from recv, to out in order of key.
+func mergeOrdered[T any](ctx context.Context, recv <-chan tagged[T], out chan<- T, key func(T) time.Time, lateness time.Duration, n int) {
+	pending := make([]*chunkList[T], n)
+	for i := range pending {
+		pending[i] = newChunkList[T](0, nil)
+	}
+	closed := make([]bool, n)
+
+	clock := clockFrom(ctx)
+	timer := stoppedTimer(clock) // Fires when the next message is lateness in the past
+	defer timer.Stop()
+
+	for {
+		// Find the earliest pending message, and whether an open input could still send an earlier one
+		first, waiting, open := -1, false, false
+		for i, p := range pending {
+			switch {
+			case p.len() > 0:
+				if first < 0 || key(p.peek()).Before(key(pending[first].peek())) {
+					first = i
+				}
+			case !closed[i]:
+				waiting = true
+			}
+
+			open = open || !closed[i]
+		}
+
+		if first < 0 && !open {
+			return // Every input is closed and everything was delivered
+		}
+
+		var send chan<- T
+		var head T
+		var wake <-chan time.Time
+		if first >= 0 {
+			head = pending[first].peek()
+
+			if wait := key(head).Add(lateness).Sub(clock.Now()); !waiting || wait <= 0 {
+				send = out
+			} else {
+				timer.Reset(wait)
+				wake = timer.C()
+			}
+		}
+
+		select {
+		case t := <-recv:
+			if t.closed {
+				closed[t.input] = true
+			} else {
+				pending[t.input].push(t.v)
+			}
+		case send <- head:
+			pending[first].pop()
+		case <-wake:
+			// The head is offered on the next iteration
+		case <-ctx.Done():
+			return
+		}
+	}
+}
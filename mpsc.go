@@ -0,0 +1,78 @@
+package unboundedchannel
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// mpsc is an intrusive multi-producer single-consumer queue, through which Queue.Push hands messages to the
+// buffering goroutine without a channel operation when WithMPSC is set.
+// Producers link nodes at head with a single swap, and the goroutine unlinks them from tail.
+type mpsc[T any] struct {
+	head   atomic.Pointer[mpscNode[T]]
+	tail   *mpscNode[T]  // Owned by the goroutine, always a node whose value was already taken
+	notify chan struct{} // Holds a token once something was pushed since the goroutine last woke up
+
+	// Pushes in progress, so the goroutine can take the last ones before intake closes
+	inflight atomic.Int64
+}
+
+type mpscNode[T any] struct {
+	next atomic.Pointer[mpscNode[T]]
+	v    T
+	vs   []T // Pushed at once by pushAll, instead of v
+	many bool
+}
+
+func newMPSC[T any]() *mpsc[T] {
+	q := &mpsc[T]{tail: new(mpscNode[T]), notify: make(chan struct{}, 1)}
+	q.head.Store(q.tail)
+
+	return q
+}
+
+// push appends v and wakes up the goroutine.
+func (q *mpsc[T]) push(v T) {
+	q.link(&mpscNode[T]{v: v})
+}
+
+// pushAll appends vs as a whole and wakes up the goroutine.
+func (q *mpsc[T]) pushAll(vs []T) {
+	q.link(&mpscNode[T]{vs: vs, many: true})
+}
+
+func (q *mpsc[T]) link(n *mpscNode[T]) {
+	q.head.Swap(n).next.Store(n)
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// drain calls fn with every message whose push has completed, in order.
+func (q *mpsc[T]) drain(fn func(T)) {
+	for {
+		next := q.tail.next.Load()
+		if next == nil {
+			if q.head.Load() == q.tail {
+				return
+			}
+
+			// A push is between swapping head and linking its node, and those after it wait behind it
+			runtime.Gosched()
+			continue
+		}
+
+		q.tail = next
+		if next.many {
+			for _, v := range next.vs {
+				fn(v)
+			}
+		} else {
+			fn(next.v)
+		}
+
+		next.v, next.vs = *new(T), nil
+	}
+}
@@ -0,0 +1,682 @@
+package unboundedchannel
+
+import (
+	"log"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Option configures the buffer created by NewWithOptions.
+type Option func(*options)
+
+// options holds the configuration collected from a list of Option.
+type options struct {
+	capacity  int // 0 means no limit
+	maxWeight int // 0 means no limit
+	sizer     any // func(T) int
+	budget    *Budget
+	overflow  OverflowPolicy
+	backing   backing
+
+	// Stores configured with element-typed funcs, such as WithPriority, are built by typed,
+	// a func(*options) store[elem[T]] named after the option that set it
+	typed       any
+	typedOption string
+
+	initialCapacity int
+	shrink          ShrinkPolicy
+
+	ttl      time.Duration
+	onExpire any // func(T)
+	due      any // func(T) time.Time
+	keep     any // func(T) bool
+	onDrop   any // func(T)
+
+	sampleEvery int     // 0 means every message
+	sampleRate  float64 // Probability of keeping a message, 0 means every message
+
+	deadLetter any // func(T, DeadReason)
+
+	onEnqueue any // func(T)
+	onDequeue any // func(T)
+	onClose   func(remaining int)
+	onPanic   func(*PanicError)
+	onWait    func(time.Duration)
+	latency   bool
+	clock     Clock
+	chaos     *Chaos
+	rates     time.Duration
+
+	high, low   int
+	onWatermark func(above bool)
+
+	drainTimeout time.Duration
+	outBuffer    int
+	spin         int
+	stuckAfter   time.Duration
+	onStuck      func(Stats)
+	idleTimeout  time.Duration // For NewQueue
+	idleDrain    bool
+	rateInterval time.Duration // Between two deliveries, 0 unless WithRateLimit
+	rateBurst    int
+	mpsc         bool                 // For NewQueue
+	visibility   time.Duration        // For NewQueue, 0 unless WithAck
+	requeueFront bool                 // For NewQueue
+	maxAttempts  int                  // For NewQueue, 0 means no limit
+	onExhausted  any                  // func(T), for NewQueue
+	leakCheck    func(created []byte) // For NewQueue
+	expvarName   string
+	logger       *slog.Logger
+	name         string
+	registry     *Registry
+
+	replay     int // For NewBroadcaster
+	roundRobin int // For NewFanOut, the number of outputs
+}
+
+// OverflowPolicy selects what happens to a write that arrives while a bounded buffer is full.
+type OverflowPolicy int
+
+const (
+	// Block stops reading from in until the consumer makes room, so writes block.
+	Block OverflowPolicy = iota
+
+	// DropOldest discards the head of the buffer, the message that would be delivered next,
+	// to make room for the write.
+	DropOldest
+
+	// DropNewest accepts the write and discards it.
+	DropNewest
+)
+
+// String returns the name of the policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case Block:
+		return "Block"
+	case DropOldest:
+		return "DropOldest"
+	case DropNewest:
+		return "DropNewest"
+	default:
+		return "OverflowPolicy(" + strconv.Itoa(int(p)) + ")"
+	}
+}
+
+// WithCapacity limits the buffer to at most max elements.
+// What happens once it is full is selected by WithOverflow and defaults to Block.
+// WithCapacity panics if max is less than 1.
+func WithCapacity(max int) Option {
+	if max < 1 {
+		panic("unboundedchannel: capacity must be positive")
+	}
+
+	return func(o *options) {
+		o.capacity = max
+	}
+}
+
+// WithSizer measures each message with size, for example in bytes, so that WithMaxWeight can bound the total
+// size of the buffer and Queue.Weight can report it. size must return the same value for a message each time.
+// The element type of size must match the buffer's, or the constructor panics.
+func WithSizer[T any](size func(T) int) Option {
+	return func(o *options) {
+		o.sizer = size
+	}
+}
+
+// WithMaxWeight limits the total size of the buffered messages, as measured by WithSizer, to max. What happens
+// once it is reached is selected by WithOverflow, as with WithCapacity: Block stops reading until the total
+// falls below max, DropOldest discards messages from the head until a new one fits, and DropNewest discards a
+// new message that doesn't fit. A single message larger than max is still accepted into an empty buffer.
+// The constructor panics if WithSizer is not set. WithMaxWeight panics if max is less than 1.
+func WithMaxWeight(max int) Option {
+	if max < 1 {
+		panic("unboundedchannel: max weight must be positive")
+	}
+
+	return func(o *options) {
+		o.maxWeight = max
+	}
+}
+
+// WithBudget counts the buffered messages against budget, which may be shared with other buffers, so the total
+// size of their messages stays within it. Once the budget is used up, the overflow policy applies as it does for
+// WithMaxWeight: a blocking buffer stops reading until any of the buffers sharing the budget delivers, and the
+// others discard messages. Without WithSizer, each message counts for the shallow size of its type, so that
+// a budget of bytes approximates the memory held by the buffers.
+func WithBudget(budget *Budget) Option {
+	return func(o *options) {
+		o.budget = budget
+	}
+}
+
+// WithOverflow sets the policy applied when a bounded buffer is full.
+// It has no effect without WithCapacity, WithMaxWeight or WithBudget.
+func WithOverflow(policy OverflowPolicy) Option {
+	return func(o *options) {
+		o.overflow = policy
+	}
+}
+
+// WithRingBuffer keeps messages in a circular buffer that grows by doubling and is reused once emptied,
+// instead of the default pooled chunks. It suits workloads with a roughly steady-state depth,
+// at the cost of holding on to the largest size the buffer has reached.
+func WithRingBuffer() Option {
+	return func(o *options) {
+		o.backing = ringed
+	}
+}
+
+// WithPriority delivers messages in priority order instead of FIFO: a message a is delivered before b if
+// less(a, b). Messages of equal priority are delivered in the order they were written.
+// The element type of less must match the buffer's, or the constructor panics.
+func WithPriority[T any](less func(a, b T) bool) Option {
+	return withTyped("WithPriority", func(o *options) store[elem[T]] {
+		return newPriorityHeap(func(a, b elem[T]) bool { return less(a.v, b.v) }, o.initialCapacity, o.shrink)
+	})
+}
+
+// WithConflate keeps only the latest message per key, as extracted by key: a message whose key is already
+// buffered replaces the pending one in place instead of being appended, so memory is bounded by the number of
+// distinct keys. Messages are delivered in the order their key was first buffered.
+// The element type of key must match the buffer's, or the constructor panics.
+func WithConflate[T any, K comparable](key func(T) K) Option {
+	return withTyped("WithConflate", func(o *options) store[elem[T]] {
+		return newKeyed(func(e elem[T]) K { return key(e.v) }, nil, o.initialCapacity, o.shrink)
+	})
+}
+
+// WithCoalesce is like WithConflate, except that a message whose key is already buffered is combined with
+// the pending one as merge(old, new) rather than replacing it, for example to sum deltas.
+// The element type of key and merge must match the buffer's, or the constructor panics.
+func WithCoalesce[T any, K comparable](key func(T) K, merge func(old, new T) T) Option {
+	return withTyped("WithCoalesce", func(o *options) store[elem[T]] {
+		// The merged message counts as written by the latest write
+		return newKeyed(func(e elem[T]) K { return key(e.v) }, func(old, new elem[T]) elem[T] {
+			return elem[T]{v: merge(old.v, new.v), at: new.at}
+		}, o.initialCapacity, o.shrink)
+	})
+}
+
+// WithDedup is like WithConflate, except that a message whose key is already buffered is dropped and the
+// pending one is kept, so re-enqueueing the same task repeatedly is free until it is delivered.
+// Queue.Duplicates counts the suppressed messages.
+// The element type of key must match the buffer's, or the constructor panics.
+func WithDedup[T any, K comparable](key func(T) K) Option {
+	return withTyped("WithDedup", func(o *options) store[elem[T]] {
+		return newKeyed(func(e elem[T]) K { return key(e.v) }, func(old, _ elem[T]) elem[T] { return old }, o.initialCapacity, o.shrink)
+	})
+}
+
+// WithSpill keeps at most threshold messages in memory, and writes the others to a temporary file in dir,
+// encoded with codec, reading them back in order as the consumer catches up. An empty dir means os.TempDir.
+// The file is removed once the buffer is drained or exits. If the disk fails, messages that can't be written
+// stay in memory, while those that can't be read back are lost; both are logged with WithLogger, if set.
+// The element type of codec must match the buffer's, or the constructor panics.
+// WithSpill panics if threshold is less than 1.
+func WithSpill[T any](dir string, threshold int, codec Codec[T]) Option {
+	if threshold < 1 {
+		panic("unboundedchannel: spill threshold must be positive")
+	}
+
+	return withTyped("WithSpill", func(o *options) store[elem[T]] {
+		return newSpill(dir, threshold, codec, o)
+	})
+}
+
+// withTyped selects a store built by newStore, which needs the element type.
+func withTyped[T any](option string, newStore func(*options) store[elem[T]]) Option {
+	return func(o *options) {
+		o.backing = typed
+		o.typed = newStore
+		o.typedOption = option
+	}
+}
+
+// WithLIFO delivers the most recently written message first instead of the oldest.
+// Combined with WithCapacity, DropOldest discards the newest buffered message, the one that would be
+// delivered next.
+func WithLIFO() Option {
+	return func(o *options) {
+		o.backing = stacked
+	}
+}
+
+// WithInitialCapacity preallocates room for n messages, so bursty workloads don't pay for repeated growth
+// at startup. The buffer keeps at least that much allocated when it drains, instead of releasing it.
+// WithInitialCapacity panics if n is negative.
+func WithInitialCapacity(n int) Option {
+	if n < 0 {
+		panic("unboundedchannel: initial capacity must not be negative")
+	}
+
+	return func(o *options) {
+		o.initialCapacity = n
+	}
+}
+
+// ShrinkPolicy decides whether a buffer releases the memory it is not using, given the number of messages
+// it holds and the number it has room for. It is consulted as messages are consumed.
+//
+// By default the chunks backing a buffer are released as soon as they are consumed, and a ring buffer,
+// priority heap or LIFO stack keeps the largest size it has reached. Neither shrinks below WithInitialCapacity.
+type ShrinkPolicy func(length, capacity int) bool
+
+// ShrinkNever keeps all memory a buffer has allocated, so long-lived queues with steady traffic
+// don't allocate again after warming up.
+func ShrinkNever(length, capacity int) bool {
+	return false
+}
+
+// ShrinkWhenEmpty releases memory only once the buffer has fully drained.
+func ShrinkWhenEmpty(length, capacity int) bool {
+	return length == 0
+}
+
+// ShrinkWhenSparse returns a ShrinkPolicy that releases memory once capacity exceeds factor times length.
+func ShrinkWhenSparse(factor int) ShrinkPolicy {
+	return func(length, capacity int) bool {
+		return capacity > factor*length
+	}
+}
+
+// WithShrinkPolicy sets when the buffer releases unused memory.
+func WithShrinkPolicy(policy ShrinkPolicy) Option {
+	return func(o *options) {
+		o.shrink = policy
+	}
+}
+
+// WithOutBuffer gives out room for n messages, so the buffering goroutine can stay ahead of a bursty consumer
+// instead of handing over one message at a time. Messages moved into out are no longer part of the buffer:
+// they are not counted by Len, don't expire, and are not seen by Peek, TryPop nor PopUpTo, which may return
+// messages ahead of them. WithOutBuffer panics if n is less than 1.
+func WithOutBuffer(n int) Option {
+	if n < 1 {
+		panic("unboundedchannel: out buffer must be positive")
+	}
+
+	return func(o *options) {
+		o.outBuffer = n
+	}
+}
+
+// WithMPSC makes Queue.Push and Queue.PushAll hand messages to the buffering goroutine through a lock-free
+// queue instead of a channel, which scales better with many concurrent producers. They then never block, and
+// messages from concurrent producers are interleaved in the order they linked into it, while each producer's
+// messages keep their order. Only NewQueue honors WithMPSC, and only when the queue is unbounded, by
+// WithCapacity, WithMaxWeight and WithBudget alike, or drops on overflow, since Push must otherwise wait for room.
+func WithMPSC() Option {
+	return func(o *options) {
+		o.mpsc = true
+	}
+}
+
+// WithAck makes a Queue deliver messages handed out by Queue.Receive at least once: each one must be
+// acknowledged with Delivery.Ack, or it is delivered again, at the back of the queue, once visibility has
+// passed. A consumer crashing or giving up on a message therefore doesn't lose it. The queue stops only once
+// closed, drained and every delivery acknowledged. Messages taken with Pop, PopUpTo or from Out are still
+// acknowledged as they are delivered. WithAck panics if visibility is not positive, and NewDurableQueue panics
+// with it, since its log doesn't keep deliveries until they are acknowledged.
+func WithAck(visibility time.Duration) Option {
+	if visibility <= 0 {
+		panic("unboundedchannel: visibility must be positive")
+	}
+
+	return func(o *options) {
+		o.visibility = visibility
+	}
+}
+
+// WithRequeueFront makes messages given back by Delivery.Nack, or whose visibility timeout passed, go back to
+// the front of the queue under WithAck, so they are delivered next, rather than to the back.
+func WithRequeueFront() Option {
+	return func(o *options) {
+		o.requeueFront = true
+	}
+}
+
+// WithMaxAttempts limits how many times WithAck delivers a message: once its nth delivery is nacked or times
+// out, it is passed to exhausted, if not nil, from the buffering goroutine instead of going back to the queue.
+// The element type of exhausted must match the queue's, or NewQueue panics.
+// WithMaxAttempts panics if n is less than 1.
+func WithMaxAttempts[T any](n int, exhausted func(T)) Option {
+	if n < 1 {
+		panic("unboundedchannel: max attempts must be positive")
+	}
+
+	return func(o *options) {
+		o.maxAttempts = n
+		if exhausted != nil {
+			o.onExhausted = exhausted
+		}
+	}
+}
+
+// WithRateLimit releases messages from the buffer at no more than perSecond on average, with bursts of up to
+// burst messages after a quiet spell, as with a token bucket. Writes are not held back, so the buffer absorbs
+// bursts of writes and smooths them out, for example toward a rate limited API.
+// WithRateLimit panics if perSecond is not positive or burst is less than 1.
+func WithRateLimit(perSecond float64, burst int) Option {
+	if perSecond <= 0 || burst < 1 {
+		panic("unboundedchannel: rate limit and burst must be positive")
+	}
+
+	interval := max(time.Duration(float64(time.Second)/perSecond), 1)
+
+	return func(o *options) {
+		o.rateInterval, o.rateBurst = interval, burst
+	}
+}
+
+// WithSampleEvery keeps only the first of every n messages that pass WithFilter, skipping the others as they
+// arrive, for cheap downsampling of high-volume streams. Queue.Sampled counts skipped messages.
+// WithSampleEvery panics if n is less than 1.
+func WithSampleEvery(n int) Option {
+	if n < 1 {
+		panic("unboundedchannel: sample every n must be positive")
+	}
+
+	return func(o *options) {
+		o.sampleEvery, o.sampleRate = n, 0
+	}
+}
+
+// WithSampleRate keeps each message that passes WithFilter with probability p, skipping it otherwise, like
+// WithSampleEvery but without a regular pattern. Queue.Sampled counts skipped messages.
+// WithSampleRate panics unless 0 < p <= 1.
+func WithSampleRate(p float64) Option {
+	if !(p > 0 && p <= 1) {
+		panic("unboundedchannel: sample rate must be in (0, 1]")
+	}
+
+	return func(o *options) {
+		o.sampleEvery, o.sampleRate = 0, p
+	}
+}
+
+// WithIdleTimeout closes a Queue that received no message for d, so forgotten queues, such as per-connection
+// ones, release their goroutine. With drain, the queue closes like Close and still delivers the messages it
+// holds; otherwise it stops right away and discards them like its context being done. Queue.Err then
+// returns ErrIdle. Only NewQueue honors WithIdleTimeout, since nothing tells the writers of an in channel it
+// stopped reading. WithIdleTimeout panics if d is not positive.
+func WithIdleTimeout(d time.Duration, drain bool) Option {
+	if d <= 0 {
+		panic("unboundedchannel: idle timeout must be positive")
+	}
+
+	return func(o *options) {
+		o.idleTimeout, o.idleDrain = d, drain
+	}
+}
+
+// WithWatchdog reports a consumer that stopped taking messages: once the message offered next has waited for
+// threshold, fn is called from the buffering goroutine with the buffer's statistics, or a warning is logged
+// with WithLogger if fn is nil. It is reported once, until a head younger than threshold shows the consumer
+// caught up. Messages held back by Queue.Pause or WithDeliverAt are not reported.
+// WithWatchdog panics if threshold is not positive.
+func WithWatchdog(threshold time.Duration, fn func(Stats)) Option {
+	if threshold <= 0 {
+		panic("unboundedchannel: watchdog threshold must be positive")
+	}
+
+	return func(o *options) {
+		o.stuckAfter, o.onStuck = threshold, fn
+	}
+}
+
+// WithSpin makes the buffering goroutine poll for up to n more rounds after handling a message before
+// parking, so a message arriving or a consumer showing up shortly after is handled without the scheduler
+// waking it up. It trades CPU time for lower handoff latency, and is meant for latency sensitive workloads with
+// spare cores. WithSpin panics if n is less than 1.
+func WithSpin(n int) Option {
+	if n < 1 {
+		panic("unboundedchannel: spin must be positive")
+	}
+
+	return func(o *options) {
+		o.spin = n
+	}
+}
+
+// WithTTL skips messages that have been buffered for longer than ttl instead of delivering them.
+// Expiry is checked as a message reaches the head of the buffer, so with WithPriority or WithLIFO a stale
+// message can sit behind fresher ones until it would be delivered. Queue.Expired counts skipped messages.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithOnExpire calls fn from the buffering goroutine with each message skipped by WithTTL.
+// fn must not block. The element type of fn must match the buffer's, or the constructor panics.
+func WithOnExpire[T any](fn func(T)) Option {
+	return func(o *options) {
+		o.onExpire = fn
+	}
+}
+
+// WithOnDrop calls fn from the buffering goroutine with each message that is lost without being delivered:
+// discarded by the overflow policy of a full buffer, or still buffered when the buffer stops early because its
+// context is done or the queue is discarded. The element type of fn must match the buffer's, or the
+// constructor panics.
+func WithOnDrop[T any](fn func(T)) Option {
+	return func(o *options) {
+		o.onDrop = fn
+	}
+}
+
+// WithOnEnqueue calls fn from the buffering goroutine with each message as it is buffered, after WithFilter
+// and the overflow policy. The element type of fn must match the buffer's, or the constructor panics.
+func WithOnEnqueue[T any](fn func(T)) Option {
+	return func(o *options) {
+		o.onEnqueue = fn
+	}
+}
+
+// WithOnDequeue calls fn from the buffering goroutine with each message as it is delivered.
+// The element type of fn must match the buffer's, or the constructor panics.
+func WithOnDequeue[T any](fn func(T)) Option {
+	return func(o *options) {
+		o.onDequeue = fn
+	}
+}
+
+// WithOnClose calls fn from the buffering goroutine as it exits, just before out is closed, with the number
+// of messages left undelivered: 0 after a clean drain, or what was discarded when stopping early.
+func WithOnClose(fn func(remaining int)) Option {
+	return func(o *options) {
+		o.onClose = fn
+	}
+}
+
+// WithOnPanic recovers from a panic in the buffering goroutine, such as one raised by a func passed to another
+// option or by a Codec, instead of letting it crash the process. The buffer then stops as if its context were
+// done, Queue.Err returns the PanicError, and fn is called with it from the buffering goroutine. Hooks run as
+// the buffer stops, such as WithOnDrop for the messages left and WithOnClose, are recovered too, and fn is
+// called again for each of their panics, after which the messages left are no longer reported.
+func WithOnPanic(fn func(err *PanicError)) Option {
+	return func(o *options) {
+		o.onPanic = fn
+	}
+}
+
+// WithWaitObserver calls fn from the buffering goroutine with how long each delivered message waited in
+// the buffer, from being accepted to being handed to a consumer, for feeding a latency histogram.
+func WithWaitObserver(fn func(wait time.Duration)) Option {
+	return func(o *options) {
+		o.onWait = fn
+	}
+}
+
+// WithClock makes the buffer tell the time and wait with c rather than its context's clock, see Clock.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithChaos injects the faults set by c, to harden code downstream against the worst a buffer may do. It is
+// meant for tests: delays and drops give up on timeliness and delivery, and Reorder on FIFO order.
+// Dropped messages are counted by Queue.Dropped and passed to WithOnDrop and WithDeadLetter like those of a
+// full buffer.
+// WithChaos panics if c.Delay or c.Reorder is negative, or c.Drop is not between 0 and 1.
+func WithChaos(c Chaos) Option {
+	if c.Delay < 0 || c.Reorder < 0 {
+		panic("unboundedchannel: chaos delay and reorder must not be negative")
+	}
+	if c.Drop < 0 || c.Drop > 1 {
+		panic("unboundedchannel: chaos drop must be between 0 and 1")
+	}
+
+	return func(o *options) {
+		o.chaos = &c
+	}
+}
+
+// WithLatency tracks how long delivered messages wait in the buffer, so Queue.Latency can report percentiles.
+func WithLatency() Option {
+	return func(o *options) {
+		o.latency = true
+	}
+}
+
+// WithRates tracks how many messages per second the buffer accepts and delivers over the last window, so
+// Queue.Rates can tell whether consumers keep up, for example to decide when to add some.
+// WithRates panics if window is not positive.
+func WithRates(window time.Duration) Option {
+	if window <= 0 {
+		panic("unboundedchannel: rates window must be positive")
+	}
+
+	return func(o *options) {
+		o.rates = window
+	}
+}
+
+// WithWatermarks calls fn from the buffering goroutine with true when the number of buffered messages
+// reaches high, and with false when it then falls back to low, so producers can slow down before memory
+// becomes a problem. WithWatermarks panics unless 0 <= low < high.
+func WithWatermarks(high, low int, fn func(above bool)) Option {
+	if low < 0 || low >= high {
+		panic("unboundedchannel: watermarks must satisfy 0 <= low < high")
+	}
+
+	return func(o *options) {
+		o.high, o.low, o.onWatermark = high, low, fn
+	}
+}
+
+// WithDeliverAt holds each message until the time returned by due, and delivers messages in order of that
+// time instead of FIFO. Messages due at the same time are delivered in the order they were written.
+// Writes still never block, and closing in delivers the remaining messages as they become due.
+// The element type of due must match the buffer's, or the constructor panics.
+func WithDeliverAt[T any](due func(T) time.Time) Option {
+	byDue := withTyped("WithDeliverAt", func(o *options) store[elem[T]] {
+		return newPriorityHeap(func(a, b elem[T]) bool { return due(a.v).Before(due(b.v)) }, o.initialCapacity, o.shrink)
+	})
+
+	return func(o *options) {
+		byDue(o)
+		o.due = due
+	}
+}
+
+// WithReplay makes a Broadcaster deliver up to the n most recent messages to each new subscriber,
+// so late subscribers start with some context. It has no effect on other constructors.
+func WithReplay(n int) Option {
+	return func(o *options) {
+		o.replay = n
+	}
+}
+
+// WithFilter discards every message for which keep returns false, inside the buffering goroutine, before it
+// takes any room in the buffer. With NewMap, keep sees converted messages. Queue.Filtered counts discards.
+// The element type of keep must match the buffer's, or the constructor panics.
+func WithFilter[T any](keep func(T) bool) Option {
+	return func(o *options) {
+		o.keep = keep
+	}
+}
+
+// WithDrainOnCancel keeps delivering the messages already buffered for up to timeout once the context is
+// done, instead of discarding them right away. New writes are no longer accepted in the meantime.
+// out is closed once the buffer drains or timeout elapses, whichever comes first.
+func WithDrainOnCancel(timeout time.Duration) Option {
+	return func(o *options) {
+		o.drainTimeout = timeout
+	}
+}
+
+// WithLeakCheck is a debugging aid that calls report if a Queue becomes unreachable while its buffering
+// goroutine is still running, which usually means it was never closed or drained. report receives the stack
+// trace of the call that created the queue, and runs on a finalizer goroutine. A nil report logs the trace
+// with the log package. Only NewQueue honors WithLeakCheck, since a channel pair can't carry a finalizer.
+func WithLeakCheck(report func(created []byte)) Option {
+	if report == nil {
+		report = func(created []byte) {
+			log.Printf("unboundedchannel: queue leaked, created at:\n%s", created)
+		}
+	}
+
+	return func(o *options) {
+		o.leakCheck = report
+	}
+}
+
+// WithExpvar publishes the buffer's statistics with the expvar package under name, as a map of its length,
+// high-water mark and counters, so they show up on /debug/vars. Like expvar.Publish, the constructor panics
+// if name is already in use. Published variables can't be removed, so WithExpvar is meant for long-lived
+// buffers.
+func WithExpvar(name string) Option {
+	return func(o *options) {
+		o.expvarName = name
+	}
+}
+
+// WithLogger logs notable events of the buffer with logger: reaching its capacity, growing past a new power
+// of two from 1024 messages on, which usually means the consumer is slow, and stopping with messages left
+// undelivered. Events carry the name set by WithName, if any.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithRegistry lists the buffer in r, or in DefaultRegistry if r is nil, under the name set by WithName for as
+// long as its goroutine runs. Listed buffers keep the time each message was written, so Stats.HeadAge is
+// known. The constructor panics if the buffer has no name, or if r already lists a live
+// buffer with the same name. NewSharded, Demux and Broadcaster.Subscribe list each buffer they start under
+// name followed by its shard, key or subscription, so they can share the options.
+func WithRegistry(r *Registry) Option {
+	if r == nil {
+		r = DefaultRegistry
+	}
+
+	return func(o *options) {
+		o.registry = r
+	}
+}
+
+// withSuffix appends suffix to the names set by WithName and WithExpvar, for constructors that start several
+// buffers with the same options.
+func withSuffix(suffix string) Option {
+	return func(o *options) {
+		if o.name != "" {
+			o.name += suffix
+		}
+		if o.expvarName != "" {
+			o.expvarName += suffix
+		}
+	}
+}
+
+// WithName names the buffer in the events logged by WithLogger, in the Registry set by WithRegistry, and in
+// goroutine profiles, where the buffering goroutine carries an "unboundedchannel.queue" pprof label.
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
@@ -0,0 +1,13 @@
+package unboundedchannel
+
+import "testing"
+
+func TestWithInitialCapacityNegative(t *testing.T) {
+	defer func() {
+		if r := recover(); r != "unboundedchannel: initial capacity must not be negative" {
+			t.Errorf("recovered %v", r)
+		}
+	}()
+
+	WithInitialCapacity(-1)
+}
@@ -0,0 +1,77 @@
+package unboundedchannel
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Sequenced is a message tagged by OrderCheck.Tag with its producer and sequence number.
+type Sequenced[T any] struct {
+	Value    T
+	Producer int    // Messages of the same producer must stay in order
+	Seq      uint64 // Position among the messages of Producer, from 1
+}
+
+// OrderError is the error an OrderCheck reports for a message that left a buffer out of order.
+type OrderError struct {
+	Producer int
+	Seq      uint64 // Of the message out of order
+	After    uint64 // Of the message of the same producer seen before it
+}
+
+// Error describes the violation.
+func (e *OrderError) Error() string {
+	return fmt.Sprintf("unboundedchannel: message %d of producer %d left after message %d", e.Seq, e.Producer, e.After)
+}
+
+// OrderCheck verifies that messages leave a buffer in the order they entered it, for example in race-enabled
+// tests of NewSharded or WithMPSC, where only messages of the same producer or input are ordered. Producers tag
+// messages with Tag before writing them, and the consumer unwraps them with Verify, which expects the
+// sequence numbers of every producer to increase. Gaps are allowed, since messages may be dropped, expired or
+// filtered, but a message seen after a later one or twice is reported. It is safe for concurrent use.
+type OrderCheck[T any] struct {
+	fail func(error)
+
+	mu   sync.Mutex
+	next map[int]uint64 // Last sequence number tagged, by producer
+	seen map[int]uint64 // Last sequence number verified, by producer
+}
+
+// NewOrderCheck returns an OrderCheck that calls fail with an *OrderError for every message out of order, for
+// example t.Error, or panics with it if fail is nil.
+func NewOrderCheck[T any](fail func(error)) *OrderCheck[T] {
+	return &OrderCheck[T]{fail: fail, next: make(map[int]uint64), seen: make(map[int]uint64)}
+}
+
+// Tag returns v wrapped with the next sequence number of producer. Each producer must tag its messages in
+// the order it writes them.
+func (c *OrderCheck[T]) Tag(producer int, v T) Sequenced[T] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.next[producer]++
+
+	return Sequenced[T]{Value: v, Producer: producer, Seq: c.next[producer]}
+}
+
+// Verify returns the value of s, after reporting it if a message of the same producer with a sequence number
+// as high or higher was verified before.
+func (c *OrderCheck[T]) Verify(s Sequenced[T]) T {
+	c.mu.Lock()
+	last := c.seen[s.Producer]
+	if s.Seq > last {
+		c.seen[s.Producer] = s.Seq
+	}
+	c.mu.Unlock()
+
+	if s.Seq <= last {
+		err := &OrderError{Producer: s.Producer, Seq: s.Seq, After: last}
+		if c.fail == nil {
+			panic(err)
+		}
+
+		c.fail(err)
+	}
+
+	return s.Value
+}
@@ -0,0 +1,12 @@
+module github.com/launch-lab-public/unboundedchannel/otel
+
+go 1.23.5
+
+require (
+	github.com/launch-lab-public/unboundedchannel v0.0.0
+	go.opentelemetry.io/otel v1.32.0
+	go.opentelemetry.io/otel/metric v1.32.0
+	go.opentelemetry.io/otel/trace v1.32.0
+)
+
+replace github.com/launch-lab-public/unboundedchannel => ../
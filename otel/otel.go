@@ -0,0 +1,148 @@
+// Package otel records the statistics of an unboundedchannel.Queue as OpenTelemetry metrics, and carries
+// trace context across the queue so consumer spans can link to the producer spans that enqueued each message.
+//
+// Like the prometheus sub-package, Metrics are created before their queue, so that the wait histogram can
+// be passed to NewQueue, and are then pointed at the queue with Watch:
+//
+//	m, err := otel.NewMetrics("jobs", meter)
+//	q := unboundedchannel.NewQueue[otel.Traced[Job]](ctx, m.Option())
+//	m.Watch(q)
+//
+//	q.Push(ctx, otel.Wrap(ctx, job))
+//
+//	t, _ := q.Pop(ctx)
+//	ctx, span := t.Start(ctx, tracer, "process job")
+//	defer span.End()
+package otel
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/launch-lab-public/unboundedchannel"
+)
+
+// Source is the part of unboundedchannel.Queue Metrics read from.
+type Source interface {
+	Len() int
+	MaxLen() int
+	Enqueued() uint64
+	Dequeued() uint64
+	Dropped() uint64
+}
+
+// Metrics are the OpenTelemetry instruments for a single queue.
+type Metrics struct {
+	mu  sync.Mutex
+	src Source
+
+	attrs metric.MeasurementOption
+	wait  metric.Float64Histogram
+}
+
+// NewMetrics creates the instruments for the queue named name with meter. Every measurement carries a
+// "queue" attribute set to name, so several queues can share the same instruments.
+func NewMetrics(name string, meter metric.Meter) (*Metrics, error) {
+	m := &Metrics{attrs: metric.WithAttributes(attribute.String("queue", name))}
+
+	length, err := meter.Int64ObservableGauge("unboundedchannel.length",
+		metric.WithDescription("Messages currently buffered."), metric.WithUnit("{message}"))
+	if err != nil {
+		return nil, err
+	}
+
+	maxLength, err := meter.Int64ObservableGauge("unboundedchannel.max_length",
+		metric.WithDescription("Highest number of messages buffered at once."), metric.WithUnit("{message}"))
+	if err != nil {
+		return nil, err
+	}
+
+	enqueued, err := meter.Int64ObservableCounter("unboundedchannel.enqueued",
+		metric.WithDescription("Messages accepted into the queue."), metric.WithUnit("{message}"))
+	if err != nil {
+		return nil, err
+	}
+
+	dequeued, err := meter.Int64ObservableCounter("unboundedchannel.dequeued",
+		metric.WithDescription("Messages delivered by the queue."), metric.WithUnit("{message}"))
+	if err != nil {
+		return nil, err
+	}
+
+	dropped, err := meter.Int64ObservableCounter("unboundedchannel.dropped",
+		metric.WithDescription("Messages discarded because the queue was full."), metric.WithUnit("{message}"))
+	if err != nil {
+		return nil, err
+	}
+
+	m.wait, err = meter.Float64Histogram("unboundedchannel.wait",
+		metric.WithDescription("Time messages spent buffered before being delivered."), metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		m.mu.Lock()
+		src := m.src
+		m.mu.Unlock()
+
+		if src == nil {
+			return nil
+		}
+
+		o.ObserveInt64(length, int64(src.Len()), m.attrs)
+		o.ObserveInt64(maxLength, int64(src.MaxLen()), m.attrs)
+		o.ObserveInt64(enqueued, int64(src.Enqueued()), m.attrs)
+		o.ObserveInt64(dequeued, int64(src.Dequeued()), m.attrs)
+		o.ObserveInt64(dropped, int64(src.Dropped()), m.attrs)
+
+		return nil
+	}, length, maxLength, enqueued, dequeued, dropped)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Option returns the option that feeds the wait histogram. It must be passed to the constructor of the
+// queue the metrics watch.
+func (m *Metrics) Option() unboundedchannel.Option {
+	return unboundedchannel.WithWaitObserver(func(wait time.Duration) {
+		m.wait.Record(context.Background(), wait.Seconds(), m.attrs)
+	})
+}
+
+// Watch makes the metrics observe the statistics of src. Until Watch is called, only the wait histogram
+// is recorded.
+func (m *Metrics) Watch(src Source) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.src = src
+}
+
+// Traced is a message along with the span context of the producer that enqueued it.
+type Traced[T any] struct {
+	Value T
+	Span  trace.SpanContext
+}
+
+// Wrap returns v along with the span context found in ctx, for pushing onto a queue.
+func Wrap[T any](ctx context.Context, v T) Traced[T] {
+	return Traced[T]{Value: v, Span: trace.SpanContextFromContext(ctx)}
+}
+
+// Start starts a consumer span with tracer, linked to the producer span the message was wrapped with, if any.
+func (t Traced[T]) Start(ctx context.Context, tracer trace.Tracer, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if t.Span.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: t.Span}))
+	}
+
+	return tracer.Start(ctx, name, opts...)
+}
@@ -0,0 +1,115 @@
+package unboundedchannel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// NewPipe returns an in-memory pipe like io.Pipe, except that writes don't wait for reads: every write is
+// copied into a Queue buffered according to opts, and reads consume the buffered bytes in order.
+// WithMaxWeight, along with a WithSizer returning the length of each chunk, bounds the bytes buffered so
+// writes wait for room.
+// The provided ctx is used to stop the pipe early, after which reads report its cause.
+func NewPipe(ctx context.Context, opts ...Option) (*PipeReader, *PipeWriter) {
+	q := NewQueue[[]byte](ctx, opts...)
+
+	return &PipeReader{q: q}, &PipeWriter{q: q}
+}
+
+// PipeReader is the read half of a pipe returned by NewPipe.
+type PipeReader struct {
+	q      *Queue[[]byte]
+	closed atomic.Bool
+
+	mu   sync.Mutex // Guards rest, so reads may be concurrent like those of io.PipeReader
+	rest []byte     // Unread end of the last chunk
+}
+
+// Read reads up to len(p) bytes from the pipe, waiting for the writer if nothing is buffered. Once the writer
+// is closed and every byte read, it returns io.EOF, or the error passed to PipeWriter.CloseWithError.
+// After PipeReader.Close it returns io.ErrClosedPipe.
+func (r *PipeReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed.Load() {
+		return 0, io.ErrClosedPipe
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if len(r.rest) == 0 {
+		chunk, ok := r.q.Pop(context.Background())
+		if !ok {
+			switch err := r.q.Err(); {
+			case r.closed.Load():
+				return 0, io.ErrClosedPipe
+			case err != nil:
+				return 0, err
+			default:
+				return 0, io.EOF
+			}
+		}
+
+		r.rest = chunk
+	}
+
+	n := copy(p, r.rest)
+	r.rest = r.rest[n:]
+
+	return n, nil
+}
+
+// Close closes the reader and discards the bytes still buffered. Writes then return io.ErrClosedPipe.
+func (r *PipeReader) Close() error {
+	r.closed.Store(true)
+	r.q.Discard()
+
+	return nil
+}
+
+// PipeWriter is the write half of a pipe returned by NewPipe.
+type PipeWriter struct {
+	q *Queue[[]byte]
+}
+
+// Write copies p into the pipe. It only waits if the pipe is bounded and full, and returns io.ErrClosedPipe
+// once the reader or writer is closed.
+func (w *PipeWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if err := w.q.Push(context.Background(), append([]byte(nil), p...)); err != nil {
+		if errors.Is(err, ErrClosed) {
+			err = io.ErrClosedPipe
+		}
+
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close closes the writer, so reads return io.EOF once every byte written was read.
+func (w *PipeWriter) Close() error {
+	w.q.Close()
+	return nil
+}
+
+// CloseWithError closes the writer, so reads return err once every byte written was read, or io.EOF if err
+// is nil.
+func (w *PipeWriter) CloseWithError(err error) error {
+	if err == nil {
+		w.q.Close()
+	} else {
+		w.q.CloseWithError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package unboundedchannel
+
+import (
+	"context"
+	"time"
+)
+
+// Pipeline builds a chain of stages that turns messages of type In into messages of type T. All the
+// stages are fused into a single buffering goroutine, so closing the input or cancelling the context shuts
+// the whole chain down at once, without ordering concerns between stages.
+//
+// A Pipeline is built by chaining methods, or Then to change the message type, and started with Run or
+// Batch. Each method returns a new Pipeline and leaves its receiver unchanged.
+type Pipeline[In, T any] struct {
+	ctx  context.Context
+	step func(In) (T, bool)
+	opts []Option
+}
+
+// NewPipeline returns a Pipeline that passes messages through unchanged until stages are added.
+// The provided ctx is used to cancel the whole chain.
+func NewPipeline[T any](ctx context.Context) *Pipeline[T, T] {
+	return &Pipeline[T, T]{ctx: ctx, step: identity[T]}
+}
+
+// Map adds a stage that converts each message with fn.
+func (p *Pipeline[In, T]) Map(fn func(T) T) *Pipeline[In, T] {
+	return Then(p, fn)
+}
+
+// Filter adds a stage that discards every message for which keep returns false.
+func (p *Pipeline[In, T]) Filter(keep func(T) bool) *Pipeline[In, T] {
+	step := p.step
+	return &Pipeline[In, T]{
+		ctx:  p.ctx,
+		opts: p.opts,
+		step: func(v In) (T, bool) {
+			t, ok := step(v)
+			return t, ok && keep(t)
+		},
+	}
+}
+
+// Buffer configures the buffer the messages are held in after the stages, for example WithCapacity.
+// The options are applied by Run; Batch ignores them.
+func (p *Pipeline[In, T]) Buffer(opts ...Option) *Pipeline[In, T] {
+	return &Pipeline[In, T]{
+		ctx:  p.ctx,
+		opts: append(p.opts[:len(p.opts):len(p.opts)], opts...),
+		step: p.step,
+	}
+}
+
+// Then adds a stage to p that converts each message to another type with fn.
+func Then[In, T, U any](p *Pipeline[In, T], fn func(T) U) *Pipeline[In, U] {
+	step := p.step
+	return &Pipeline[In, U]{
+		ctx:  p.ctx,
+		opts: p.opts,
+		step: func(v In) (U, bool) {
+			t, ok := step(v)
+			if !ok {
+				return *new(U), false
+			}
+
+			return fn(t), true
+		},
+	}
+}
+
+// Run starts the pipeline and returns its pair of channels (in, out), which behave like those of
+// NewWithOptions.
+func (p *Pipeline[In, T]) Run() (chan<- In, <-chan T) {
+	b := startConv(p.ctx, p.opts, p.step)
+	return b.in, b.out
+}
+
+// Batch starts the pipeline like Run, except that out delivers batches like NewBatching.
+// Batch panics if maxBatch is less than 1.
+func (p *Pipeline[In, T]) Batch(maxBatch int, maxWait time.Duration) (chan<- In, <-chan []T) {
+	if maxBatch < 1 {
+		panic("unboundedchannel: Pipeline.Batch maxBatch must be positive")
+	}
+
+	in := make(chan In)
+	out := make(chan []T)
+
+	// Start buffering
+	go bufferBatches(p.ctx, in, out, p.step, maxBatch, maxWait)
+
+	return in, out
+}
@@ -0,0 +1,112 @@
+// Package prometheus exports the statistics of an unboundedchannel.Queue as Prometheus metrics.
+//
+// A Collector is created before its queue, so that its wait histogram can be passed to NewQueue, and is then
+// pointed at the queue with Watch:
+//
+//	c := prometheus.NewCollector("jobs")
+//	q := unboundedchannel.NewQueue[Job](ctx, c.Option())
+//	c.Watch(q)
+//	registry.MustRegister(c)
+//
+// Every metric carries a "queue" label set to the name of the collector, so several queues can be
+// registered side by side.
+package prometheus
+
+import (
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/launch-lab-public/unboundedchannel"
+)
+
+// Source is the part of unboundedchannel.Queue a Collector reads from.
+type Source interface {
+	Len() int
+	MaxLen() int
+	Enqueued() uint64
+	Dequeued() uint64
+	Dropped() uint64
+}
+
+// Collector is a prom.Collector for a single queue.
+type Collector struct {
+	mu  sync.Mutex
+	src Source
+
+	length    *prom.Desc
+	maxLength *prom.Desc
+	enqueued  *prom.Desc
+	dequeued  *prom.Desc
+	dropped   *prom.Desc
+	wait      prom.Histogram
+}
+
+// NewCollector returns a Collector for the queue named name. wait histogram buckets default to
+// prom.DefBuckets, unless buckets are given.
+func NewCollector(name string, buckets ...float64) *Collector {
+	labels := prom.Labels{"queue": name}
+	desc := func(metric, help string) *prom.Desc {
+		return prom.NewDesc(prom.BuildFQName("unboundedchannel", "", metric), help, nil, labels)
+	}
+
+	return &Collector{
+		length:    desc("length", "Messages currently buffered."),
+		maxLength: desc("max_length", "Highest number of messages buffered at once."),
+		enqueued:  desc("enqueued_total", "Messages accepted into the queue."),
+		dequeued:  desc("dequeued_total", "Messages delivered by the queue."),
+		dropped:   desc("dropped_total", "Messages discarded because the queue was full."),
+		wait: prom.NewHistogram(prom.HistogramOpts{
+			Namespace:   "unboundedchannel",
+			Name:        "wait_seconds",
+			Help:        "Time messages spent buffered before being delivered.",
+			ConstLabels: labels,
+			Buckets:     buckets,
+		}),
+	}
+}
+
+// Option returns the option that feeds the wait histogram. It must be passed to the constructor of the
+// queue the collector watches.
+func (c *Collector) Option() unboundedchannel.Option {
+	return unboundedchannel.WithWaitObserver(func(wait time.Duration) {
+		c.wait.Observe(wait.Seconds())
+	})
+}
+
+// Watch makes the collector report the statistics of src. Until Watch is called, only the wait histogram
+// is collected.
+func (c *Collector) Watch(src Source) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.src = src
+}
+
+// Describe implements prom.Collector.
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.length
+	ch <- c.maxLength
+	ch <- c.enqueued
+	ch <- c.dequeued
+	ch <- c.dropped
+	c.wait.Describe(ch)
+}
+
+// Collect implements prom.Collector.
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	c.mu.Lock()
+	src := c.src
+	c.mu.Unlock()
+
+	if src != nil {
+		ch <- prom.MustNewConstMetric(c.length, prom.GaugeValue, float64(src.Len()))
+		ch <- prom.MustNewConstMetric(c.maxLength, prom.GaugeValue, float64(src.MaxLen()))
+		ch <- prom.MustNewConstMetric(c.enqueued, prom.CounterValue, float64(src.Enqueued()))
+		ch <- prom.MustNewConstMetric(c.dequeued, prom.CounterValue, float64(src.Dequeued()))
+		ch <- prom.MustNewConstMetric(c.dropped, prom.CounterValue, float64(src.Dropped()))
+	}
+
+	c.wait.Collect(ch)
+}
@@ -0,0 +1,80 @@
+package unboundedchannel
+
+import (
+	"context"
+	"sync"
+)
+
+// PubSub routes messages published on a topic to the subscribers of that topic, each through its own buffer,
+// with one Broadcaster per topic.
+type PubSub[K comparable, T any] struct {
+	ctx  context.Context
+	opts []Option
+
+	mu     sync.Mutex
+	topics map[K]*Broadcaster[T]
+	closed bool
+}
+
+// NewPubSub returns a PubSub whose topics are created on first use with NewBroadcaster(ctx, opts...).
+// A topic lives until the PubSub is closed.
+func NewPubSub[K comparable, T any](ctx context.Context, opts ...Option) *PubSub[K, T] {
+	return &PubSub[K, T]{
+		ctx:    ctx,
+		opts:   opts,
+		topics: make(map[K]*Broadcaster[T]),
+	}
+}
+
+// Publish sends v to every current subscriber of topic. It never blocks, and returns ErrClosed once the
+// PubSub is closed, or ctx.Err() if ctx is done first.
+func (p *PubSub[K, T]) Publish(ctx context.Context, topic K, v T) error {
+	b := p.topic(topic)
+	if b == nil {
+		return ErrClosed
+	}
+
+	return b.Publish(ctx, v)
+}
+
+// Subscribe returns a channel that receives every message published on topic from now on,
+// as Broadcaster.Subscribe does. Subscribing to a closed PubSub returns a closed channel.
+func (p *PubSub[K, T]) Subscribe(topic K, opts ...Option) (sub <-chan T, cancel func()) {
+	b := p.topic(topic)
+	if b == nil {
+		out := make(chan T)
+		close(out)
+		return out, func() {}
+	}
+
+	return b.Subscribe(opts...)
+}
+
+// Close stops accepting messages on every topic. Subscription channels are closed once they drain.
+func (p *PubSub[K, T]) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, b := range p.topics {
+		b.Close()
+	}
+}
+
+// topic returns the Broadcaster of a topic, creating it if needed, or nil once closed.
+func (p *PubSub[K, T]) topic(topic K) *Broadcaster[T] {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+
+	b, ok := p.topics[topic]
+	if !ok {
+		b = NewBroadcaster[T](p.ctx, p.opts...)
+		p.topics[topic] = b
+	}
+
+	return b
+}
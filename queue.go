@@ -0,0 +1,680 @@
+package unboundedchannel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned by Queue methods once the queue no longer accepts messages,
+// either because Close was called or because its context is done.
+var ErrClosed = errors.New("unboundedchannel: queue closed")
+
+// PanicError is the error a buffer set up with WithOnPanic stops with when its goroutine panics.
+type PanicError struct {
+	Value any    // Passed to panic
+	Stack []byte // Of the buffering goroutine, as it panicked
+}
+
+// Error returns the value passed to panic, as an error message.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("unboundedchannel: buffering goroutine panicked: %v", e.Value)
+}
+
+// ErrIdle is returned by Queue.Err once a queue set up with WithIdleTimeout closed itself.
+var ErrIdle = errors.New("unboundedchannel: queue closed after being idle")
+
+// ErrFrozen is returned by Push and PushAll while the queue is frozen by Freeze.
+var ErrFrozen = errors.New("unboundedchannel: queue frozen")
+
+// ErrPushFront is returned by Queue.PushFront on a queue from NewDurableQueue, whose log only appends messages.
+var ErrPushFront = errors.New("unboundedchannel: PushFront is not supported by durable queues")
+
+// Queue is a FIFO with the same buffering as NewWithOptions, driven through methods instead of a channel pair.
+// Unlike closing in, Close is safe to call concurrently with Push and more than once.
+// The caller must either cancel the context or call Close to eventually stop the queue, and must Pop until it
+// reports false to fully release resources, unless it calls Discard.
+type Queue[T any] struct {
+	b        *buffer[T, T]
+	closeErr atomic.Pointer[error]
+	stopOnce sync.Once
+
+	freezeMu sync.Mutex
+	frozen   atomic.Pointer[chan struct{}] // Closed by Freeze, replaced by Unfreeze
+
+	durable bool // Set by NewDurableQueue, whose log can't put messages at the front
+}
+
+// NewQueue returns a Queue configured by opts.
+// The provided ctx is used to cancel any pending operations and terminate buffering early.
+func NewQueue[T any](ctx context.Context, opts ...Option) *Queue[T] {
+	return startQueue(newBuffer(ctx, opts, identity[T]))
+}
+
+// NewFromSnapshot returns a Queue like NewQueue that starts with items buffered, in order, such as those
+// returned by Snapshot before a restart. items are buffered even beyond WithCapacity, and are not passed to
+// WithFilter nor WithOnEnqueue, since they were accepted once already.
+func NewFromSnapshot[T any](ctx context.Context, items []T, opts ...Option) *Queue[T] {
+	b := newBuffer(ctx, opts, identity[T])
+	b.restore(items)
+
+	return startQueue(b)
+}
+
+// startQueue starts the goroutine of b and returns the Queue driving it.
+func startQueue[T any](b *buffer[T, T]) *Queue[T] {
+	// Blocking for room by length, weight or budget needs Push to wait, which only the channel path does
+	unbounded := b.opts.capacity == 0 && b.opts.maxWeight == 0 && b.opts.budget == nil
+	if b.opts.mpsc && (unbounded || b.opts.overflow != Block) {
+		b.mpsc = newMPSC[T]()
+	}
+	b.idleTimeout = b.opts.idleTimeout
+
+	go b.run()
+
+	q := &Queue[T]{b: b}
+	frozen := make(chan struct{})
+	q.frozen.Store(&frozen)
+
+	if report := q.b.opts.leakCheck; report != nil {
+		// The goroutine only holds the buffer, so the queue can be collected while it runs
+		created, done := debug.Stack(), q.b.done
+		runtime.SetFinalizer(q, func(*Queue[T]) {
+			select {
+			case <-done:
+			default:
+				report(created)
+			}
+		})
+	}
+
+	return q
+}
+
+// Push appends v to the queue. It blocks only if the queue is bounded and full.
+// It returns ErrClosed if the queue is closed, ErrFrozen if it is frozen, or ctx.Err() if ctx is done first.
+func (q *Queue[T]) Push(ctx context.Context, v T) error {
+	// Never accept a message after Close or Freeze has returned
+	frozen := q.frozenCh()
+	select {
+	case <-q.b.closing:
+		return ErrClosed
+	case <-frozen:
+		return ErrFrozen
+	default:
+	}
+
+	if m := q.b.mpsc; m != nil {
+		return q.pushMPSC(m, func() { m.push(v) }, frozen)
+	}
+
+	select {
+	case q.b.in <- v:
+		return nil
+	case <-q.b.closing:
+		return ErrClosed
+	case <-frozen:
+		return ErrFrozen
+	case <-q.b.done:
+		return ErrClosed
+	case <-q.b.ctx.Done():
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pushMPSC runs push, which links messages into m, unless the queue no longer accepts messages.
+func (q *Queue[T]) pushMPSC(m *mpsc[T], push func(), frozen <-chan struct{}) error {
+	// Checked once counted as in progress, so the goroutine waits for the push if it closes intake meanwhile
+	m.inflight.Add(1)
+	defer m.inflight.Add(-1)
+
+	select {
+	case <-q.b.closing:
+		return ErrClosed
+	case <-frozen:
+		return ErrFrozen
+	case <-q.b.done:
+		return ErrClosed
+	case <-q.b.ctx.Done():
+		return ErrClosed
+	default:
+	}
+
+	push()
+	return nil
+}
+
+// PushAll appends items to the queue in order, in a single handoff to the buffering goroutine.
+// If the queue is bounded with the Block policy, the items that don't fit are held back, and the queue
+// accepts nothing else until they do. Other policies apply to each item as if it was pushed alone.
+// PushAll does not retain items, and returns the same errors as Push.
+func (q *Queue[T]) PushAll(ctx context.Context, items []T) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	// Never accept a message after Close or Freeze has returned
+	frozen := q.frozenCh()
+	select {
+	case <-q.b.closing:
+		return ErrClosed
+	case <-frozen:
+		return ErrFrozen
+	default:
+	}
+
+	// Through the same path as Push, so each producer's messages keep their order
+	if m := q.b.mpsc; m != nil {
+		return q.pushMPSC(m, func() { m.pushAll(slices.Clone(items)) }, frozen)
+	}
+
+	select {
+	case q.b.inAll <- slices.Clone(items):
+		return nil
+	case <-q.b.closing:
+		return ErrClosed
+	case <-frozen:
+		return ErrFrozen
+	case <-q.b.done:
+		return ErrClosed
+	case <-q.b.ctx.Done():
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TryPush appends v to the queue if it can do so without waiting for room, and reports whether it did.
+// It returns false if the queue is full with the Block policy, holds back items from PushAll, is closed or
+// frozen. It only waits for the buffering goroutine to answer, never for a consumer.
+func (q *Queue[T]) TryPush(v T) bool {
+	select {
+	case <-q.b.closing:
+		return false
+	default:
+	}
+
+	reply := make(chan bool, 1)
+
+	select {
+	case q.b.tries <- try[T]{v: v, reply: reply}:
+		return <-reply
+	case <-q.b.closing:
+		return false
+	case <-q.b.done:
+		return false
+	case <-q.b.ctx.Done():
+		return false
+	}
+}
+
+// Pop removes and returns the message at the head of the queue, blocking until one is available.
+// It returns false once the queue is closed and drained, or if ctx is done first.
+func (q *Queue[T]) Pop(ctx context.Context) (T, bool) {
+	select {
+	case v, ok := <-q.b.out:
+		return v, ok
+	case <-ctx.Done():
+		return *new(T), false
+	}
+}
+
+// PopContext is like Pop, except that it tells why it returned without a message: it returns false and a nil
+// error once the queue is closed and drained, or false and ctx.Err() if ctx is done first.
+func (q *Queue[T]) PopContext(ctx context.Context) (T, bool, error) {
+	select {
+	case v, ok := <-q.b.out:
+		return v, ok, nil
+	case <-ctx.Done():
+		return *new(T), false, ctx.Err()
+	}
+}
+
+// PopTimeout is like PopContext with a deadline d from now, but without allocating a context. It returns
+// context.DeadlineExceeded if no message is available in time.
+func (q *Queue[T]) PopTimeout(d time.Duration) (T, bool, error) {
+	timer := q.b.clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case v, ok := <-q.b.out:
+		return v, ok, nil
+	case <-timer.C():
+		return *new(T), false, context.DeadlineExceeded
+	}
+}
+
+// TryPop removes and returns the message at the head of the queue if one is available right away.
+// It only waits for the buffering goroutine to answer, never for a producer.
+func (q *Queue[T]) TryPop() (T, bool) {
+	reply := make(chan []T, 1)
+
+	select {
+	case q.b.polls <- take[T]{n: 1, reply: reply}:
+		if batch := <-reply; len(batch) > 0 {
+			return batch[0], true
+		}
+	case <-q.b.done:
+	}
+
+	return *new(T), false
+}
+
+// PopUpTo removes and returns up to n messages from the head of the queue in one operation, blocking until
+// at least one is available. The messages are taken atomically, so they are contiguous even with other
+// consumers. It returns false once the queue is closed and drained, or if ctx is done first.
+// PopUpTo panics if n is less than 1.
+func (q *Queue[T]) PopUpTo(ctx context.Context, n int) ([]T, bool) {
+	if n < 1 {
+		panic("unboundedchannel: PopUpTo n must be positive")
+	}
+
+	reply := make(chan []T, 1)
+
+	select {
+	case q.b.takes <- take[T]{n: n, reply: reply}:
+		return <-reply, true
+	case <-q.b.done:
+		return nil, false
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// Freeze stops the queue from accepting new messages, while those already buffered keep being delivered.
+// Unlike Close, Freeze can be undone by Unfreeze, and Out is not closed once the queue drains. Push and
+// PushAll return ErrFrozen in the meantime, including calls blocked on a full queue.
+func (q *Queue[T]) Freeze() {
+	q.freezeMu.Lock()
+	defer q.freezeMu.Unlock()
+
+	if q.isFrozen() {
+		return
+	}
+
+	// Stop intake before failing writes, so no write succeeds once Freeze returns
+	q.setFrozen(true)
+	close(q.frozenCh())
+}
+
+// Unfreeze makes the queue accept messages again after Freeze.
+func (q *Queue[T]) Unfreeze() {
+	q.freezeMu.Lock()
+	defer q.freezeMu.Unlock()
+
+	if !q.isFrozen() {
+		return
+	}
+
+	frozen := make(chan struct{})
+	q.frozen.Store(&frozen)
+	q.setFrozen(false)
+}
+
+// setFrozen hands the frozen state to the buffering goroutine, unless it has exited.
+func (q *Queue[T]) setFrozen(frozen bool) {
+	select {
+	case q.b.freeze <- frozen:
+	case <-q.b.done:
+	}
+}
+
+// frozenCh returns the channel Freeze closes, which writes keep waiting on while they block, so they fail
+// as soon as the queue is frozen.
+func (q *Queue[T]) frozenCh() chan struct{} {
+	return *q.frozen.Load()
+}
+
+// isFrozen reports whether the queue is frozen. It is called with freezeMu held.
+func (q *Queue[T]) isFrozen() bool {
+	select {
+	case <-q.frozenCh():
+		return true
+	default:
+		return false
+	}
+}
+
+// Peek returns the message at the head of the queue without removing it, blocking until one is available.
+// With other consumers, the message may be gone by the time the caller pops.
+// It returns false once the queue is closed and drained, or if ctx is done first.
+func (q *Queue[T]) Peek(ctx context.Context) (T, bool) {
+	reply := make(chan T, 1)
+
+	select {
+	case q.b.peeks <- reply:
+		return <-reply, true
+	case <-q.b.done:
+		return *new(T), false
+	case <-ctx.Done():
+		return *new(T), false
+	}
+}
+
+// Flush blocks until every message pushed before the call has left the queue: delivered, or discarded by a
+// feature such as WithTTL or the overflow policy. With a store that reorders messages, such as WithPriority or
+// WithLIFO, it waits until as many messages have left as had been pushed. Flush returns ErrClosed if the
+// queue stops with some of them undelivered, or ctx.Err() if ctx is done first.
+func (q *Queue[T]) Flush(ctx context.Context) error {
+	done := q.Barrier()
+
+	select {
+	case <-done:
+		return nil
+	case <-q.b.done:
+		return q.flushed(done)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Barrier returns a channel that is closed once every message pushed before the call has left the queue, as
+// with Flush, without waiting for it. Barriers let a pipeline mark epochs or checkpoints in the stream.
+// If the queue stops with some of those messages undelivered, the channel is never closed.
+func (q *Queue[T]) Barrier() <-chan struct{} {
+	done := make(chan struct{})
+
+	select {
+	case q.b.flush <- done:
+	case <-q.b.done:
+		if q.b.discarded == 0 {
+			close(done)
+		}
+	}
+
+	return done
+}
+
+// flushed tells whether a barrier was released by the time the buffering goroutine exited.
+func (q *Queue[T]) flushed(done <-chan struct{}) error {
+	select {
+	case <-done:
+		return nil
+	default:
+	}
+
+	if q.b.discarded == 0 {
+		return nil
+	}
+
+	return ErrClosed
+}
+
+// Pause stops the queue from delivering messages until Resume is called. Messages keep being accepted and
+// buffered in the meantime, and still expire with WithTTL. Once Pause returns, Pop and PopUpTo block.
+func (q *Queue[T]) Pause() {
+	q.setPaused(true)
+}
+
+// Resume restarts delivery after Pause.
+func (q *Queue[T]) Resume() {
+	q.setPaused(false)
+}
+
+// setPaused hands the paused state to the buffering goroutine, unless it has exited.
+func (q *Queue[T]) setPaused(paused bool) {
+	select {
+	case q.b.pause <- paused:
+	case <-q.b.done:
+	}
+}
+
+// Reset discards every message currently buffered in one operation, leaving the queue open, and returns how
+// many there were. Discarded messages are not counted by Dropped nor passed to WithOnDrop.
+func (q *Queue[T]) Reset() int {
+	reply := make(chan int, 1)
+
+	select {
+	case q.b.resets <- reply:
+		return <-reply
+	case <-q.b.done:
+		return 0
+	}
+}
+
+// PushFront puts v back at the head of the queue, so it is the next message delivered, for a consumer that
+// popped or peeked at a message it can't handle yet and wants to keep the order. Unlike Push, it bypasses
+// WithCapacity and WithFilter, and still works once the queue is closed, until it has drained and stopped.
+// It returns ErrClosed once the queue has stopped, or ctx.Err() if ctx is done first. On a queue from
+// NewDurableQueue, it returns ErrPushFront, since the message would not survive a restart.
+func (q *Queue[T]) PushFront(ctx context.Context, v T) error {
+	if q.durable {
+		return ErrPushFront
+	}
+
+	select {
+	case q.b.fronts <- v:
+		return nil
+	case <-q.b.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Snapshot returns copies of the messages currently buffered, in the order they would be delivered, without
+// removing them, so pending work can be saved during a graceful shutdown and restored by NewFromSnapshot.
+// Call Freeze first to keep the snapshot from going stale as messages are pushed.
+// Snapshot copies every message, and returns ErrClosed once the queue has stopped and its messages are gone.
+func (q *Queue[T]) Snapshot() ([]T, error) {
+	return q.snapshot(-1)
+}
+
+// snapshot returns copies of up to limit buffered messages, or all of them if limit is negative.
+func (q *Queue[T]) snapshot(limit int) ([]T, error) {
+	req := snap[T]{limit: limit, reply: make(chan []T, 1)}
+
+	select {
+	case q.b.snaps <- req:
+		return <-req.reply, nil
+	case <-q.b.done:
+		return nil, ErrClosed
+	}
+}
+
+// Inspect returns copies of up to the first n messages currently buffered, in the order they would be
+// delivered, without removing them, to see what is stuck in a queue that backs up. A negative n returns them
+// all. Inspect returns nil once the queue has stopped. Most stores stop after the first n messages, but those
+// of options such as WithPriority can only be gone through whole, like Snapshot does, so Inspect is meant for
+// debugging rather than for regular use on long queues.
+func (q *Queue[T]) Inspect(n int) []T {
+	s, _ := q.snapshot(n)
+	return s
+}
+
+// Close stops the queue from accepting new messages. Messages already pushed are still delivered by Pop.
+func (q *Queue[T]) Close() {
+	q.b.closeOnce.Do(func() {
+		close(q.b.closing)
+	})
+}
+
+// CloseWithError is like Close, except that once the queue drains, Err reports err so consumers can tell an
+// aborted producer from a clean end of stream. Only the first call to Close or CloseWithError has an effect.
+func (q *Queue[T]) CloseWithError(err error) {
+	q.b.closeOnce.Do(func() {
+		q.closeErr.Store(&err)
+		close(q.b.closing)
+	})
+}
+
+// Shutdown closes the queue and waits for the consumer to drain it. If ctx is done first, Shutdown discards
+// the messages still buffered and returns how many there were, along with ctx.Err(). Once Shutdown returns,
+// the buffering goroutine has exited and Out is closed.
+func (q *Queue[T]) Shutdown(ctx context.Context) (discarded int, err error) {
+	q.Close()
+
+	select {
+	case <-q.b.done:
+		return q.b.discarded, nil
+	case <-ctx.Done():
+		q.stop()
+		<-q.b.done
+		return q.b.discarded, ctx.Err()
+	}
+}
+
+// Discard closes the queue and drops the messages still buffered, without waiting for a consumer, and returns
+// how many there were. Once Discard returns, the buffering goroutine has exited and Out is closed, so a queue
+// nobody reads from anymore can be released without draining it.
+func (q *Queue[T]) Discard() int {
+	q.Close()
+	q.stop()
+	<-q.b.done
+
+	return q.b.discarded
+}
+
+// stop makes the buffering goroutine exit without delivering anything else.
+func (q *Queue[T]) stop() {
+	q.stopOnce.Do(func() {
+		close(q.b.stop)
+	})
+}
+
+// Err returns why the queue stopped, once Pop reports false or Out is closed: the error passed to
+// CloseWithError, the cause of its context being done, ErrIdle after WithIdleTimeout, a *PanicError with
+// WithOnPanic, or nil after a clean Close. Before that it returns nil.
+func (q *Queue[T]) Err() error {
+	select {
+	case <-q.b.done:
+	default:
+		return nil
+	}
+
+	if err := q.closeErr.Load(); err != nil {
+		return *err
+	}
+
+	return q.b.err
+}
+
+// Stats is a snapshot of the state and counters of a Queue, as returned by Queue.Stats.
+// HeadAge is only known when messages carry the time they were written, which WithTTL, WithWaitObserver,
+// WithLatency, WithRegistry and WithWatchdog turn on.
+type Stats struct {
+	Len        int    // Messages buffered
+	Cap        int    // Capacity, or 0 if unbounded
+	Weight     int    // Total size of the messages buffered, see Queue.Weight
+	MaxLen     int    // High-water mark, see Queue.MaxLen
+	Enqueued   uint64 // Messages accepted
+	Dequeued   uint64 // Messages delivered
+	Dropped    uint64 // Messages discarded by the overflow policy
+	Duplicates uint64 // Messages folded into one with the same key
+	Expired    uint64 // Messages skipped by WithTTL
+	Filtered   uint64 // Messages discarded by WithFilter
+	Sampled    uint64 // Messages skipped by WithSampleEvery and WithSampleRate
+
+	HeadAge time.Duration // How long the next message to deliver has waited, if known
+	Created time.Time     // When the queue was created
+	Age     time.Duration // How long ago the queue was created, by its Clock
+	Rates   Rates         // Over the recent window, if WithRates is set, or zero
+	Closed  bool          // Whether the queue no longer accepts messages
+}
+
+// Stats returns a snapshot of the queue's state and counters, for admin and debug endpoints.
+// The fields are read one at a time, so they may be slightly inconsistent with each other while the queue is
+// in use.
+func (q *Queue[T]) Stats() Stats {
+	return q.b.stats()
+}
+
+// Out returns the channel Pop reads from, for consumers that need to select on it alongside other channels.
+// It is closed once the queue is closed and drained, or its context is done.
+func (q *Queue[T]) Out() <-chan T {
+	return q.b.out
+}
+
+// Len returns the number of messages currently buffered.
+// It is maintained by the buffering goroutine and may briefly lag behind Push and Pop.
+func (q *Queue[T]) Len() int {
+	return int(q.b.length.Load())
+}
+
+// Weight returns the total size of the messages currently buffered, as measured by WithSizer, or 0 without it.
+// Like Len, it may briefly lag behind Push and Pop.
+func (q *Queue[T]) Weight() int {
+	return int(q.b.weight.Load())
+}
+
+// MaxLen returns the highest number of messages buffered at once since the queue was created or
+// ResetMaxLen was last called. It remains readable after the queue is closed.
+func (q *Queue[T]) MaxLen() int {
+	return int(q.b.maxLength.Load())
+}
+
+// ResetMaxLen restarts high-water mark tracking from the current length.
+func (q *Queue[T]) ResetMaxLen() {
+	q.b.maxLength.Store(q.b.length.Load())
+}
+
+// Enqueued returns the number of messages accepted into the queue so far, including those later dropped,
+// expired or folded into a buffered message with the same key.
+func (q *Queue[T]) Enqueued() uint64 {
+	return q.b.enqueued.Load()
+}
+
+// Dequeued returns the number of messages delivered by the queue so far.
+func (q *Queue[T]) Dequeued() uint64 {
+	return q.b.dequeued.Load()
+}
+
+// Latency returns percentiles of how long delivered messages waited in the queue, if it was created with
+// WithLatency. Otherwise it returns the zero Latency.
+func (q *Queue[T]) Latency() Latency {
+	if q.b.latency == nil {
+		return Latency{}
+	}
+
+	return q.b.latency.summary()
+}
+
+// Rates returns how many messages per second the queue accepted and delivered recently, if it was created
+// with WithRates. Otherwise it returns the zero Rates.
+func (q *Queue[T]) Rates() Rates {
+	if q.b.meter == nil {
+		return Rates{}
+	}
+
+	return q.b.meter.rates(q.b.now())
+}
+
+// Dropped returns the number of messages discarded so far because the queue was full.
+func (q *Queue[T]) Dropped() uint64 {
+	return q.b.dropped.Load()
+}
+
+// Duplicates returns the number of messages folded so far into a buffered message with the same key,
+// whether replaced by WithConflate, merged by WithCoalesce or suppressed by WithDedup.
+func (q *Queue[T]) Duplicates() uint64 {
+	return q.b.duplicates.Load()
+}
+
+// Expired returns the number of messages skipped so far for outliving WithTTL.
+func (q *Queue[T]) Expired() uint64 {
+	return q.b.expired.Load()
+}
+
+// Filtered returns the number of messages discarded so far by WithFilter.
+func (q *Queue[T]) Filtered() uint64 {
+	return q.b.filtered.Load()
+}
+
+// Sampled returns the number of messages skipped so far by WithSampleEvery and WithSampleRate.
+func (q *Queue[T]) Sampled() uint64 {
+	return q.b.sampled.Load()
+}
+
+// Cap returns the maximum number of messages the queue buffers, or 0 if it is unbounded.
+// Together with Len it lets callers alert on a queue that is close to full.
+func (q *Queue[T]) Cap() int {
+	return q.b.opts.capacity
+}
@@ -0,0 +1,82 @@
+package unboundedchannel
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	queues := []struct {
+		name string
+		opts []Option
+	}{
+		{"chunks", nil},
+		// Holds 3 messages in memory, so prefixes end on both sides of the file
+		{"spill", []Option{WithSpill[int](t.TempDir(), 3, JSONCodec[int]{})}},
+		// Can't be walked, so every message is popped and pushed back
+		{"priority", []Option{WithPriority(func(a, b int) bool { return a < b })}},
+	}
+
+	for _, qq := range queues {
+		t.Run(qq.name, func(t *testing.T) {
+			q := NewQueue[int](context.Background(), qq.opts...)
+			defer q.Discard()
+
+			all := []int{0, 1, 2, 3, 4, 5, 6, 7}
+			for _, v := range all {
+				q.Push(context.Background(), v)
+			}
+
+			for _, n := range []int{0, 1, 3, 5, 8, 20, -1} {
+				want := all
+				if n >= 0 {
+					want = all[:min(n, len(all))]
+				}
+
+				if got := q.Inspect(n); !slices.Equal(got, want) {
+					t.Errorf("Inspect(%d) = %v, want %v", n, got, want)
+				}
+			}
+
+			// Inspecting leaves every message in place
+			for _, want := range all {
+				if v, _ := q.Pop(context.Background()); v != want {
+					t.Fatalf("popped %d, want %d", v, want)
+				}
+			}
+		})
+	}
+}
+
+// countingCodec counts the messages it decodes.
+type countingCodec struct {
+	JSONCodec[int]
+	decoded *int
+}
+
+func (c countingCodec) Decode(data []byte) (int, error) {
+	*c.decoded++
+	return c.JSONCodec.Decode(data)
+}
+
+func TestInspectSpillReadsOnlyPrefix(t *testing.T) {
+	var decoded int
+	q := NewQueue[int](context.Background(), WithSpill[int](t.TempDir(), 3, countingCodec{decoded: &decoded}))
+	defer q.Discard()
+
+	for i := range 100 {
+		q.Push(context.Background(), i)
+	}
+
+	// decoded is only touched by the buffering goroutine, which replied to Inspect after reading
+	q.Inspect(3)
+	if decoded != 0 {
+		t.Errorf("Inspect(3) decoded %d spilled messages, want 0", decoded)
+	}
+
+	q.Inspect(5)
+	if decoded != 2 {
+		t.Errorf("Inspect(5) decoded %d spilled messages, want 2", decoded)
+	}
+}
@@ -0,0 +1,176 @@
+// Package queuetest provides a fake buffer for tests of code that writes to or reads from an unboundedchannel
+// channel pair, so they don't need to wire up and inspect a pair of channels by hand.
+//
+// A Fake is a real buffer that records every message enqueued and delivered. The code under test writes to
+// In or reads from Out, the test scripts what a consumer sees with Script and Close, and checks the results
+// with Enqueued, Delivered, AssertFIFO and AssertClosed.
+package queuetest
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/launch-lab-public/unboundedchannel"
+)
+
+// Fake is a channel pair buffered like unboundedchannel.NewWithOptions, which records every message.
+// It is safe for concurrent use.
+type Fake[T any] struct {
+	t   testing.TB
+	in  chan<- T
+	out <-chan T
+
+	mu        sync.Mutex
+	enqueued  []T
+	delivered []T
+	exited    bool          // Whether the buffering goroutine exited
+	remaining int           // Messages left undelivered as it exited
+	changed   chan struct{} // Closed and replaced whenever something is recorded
+}
+
+// New returns a Fake buffering like unboundedchannel.NewWithOptions with ctx and opts, to which it adds
+// WithOnEnqueue, WithOnDequeue and WithOnClose, replacing those of opts.
+func New[T any](ctx context.Context, t testing.TB, opts ...unboundedchannel.Option) *Fake[T] {
+	f := &Fake[T]{t: t, changed: make(chan struct{})}
+
+	opts = append(opts[:len(opts):len(opts)],
+		unboundedchannel.WithOnEnqueue(func(v T) {
+			f.record(func() { f.enqueued = append(f.enqueued, v) })
+		}),
+		unboundedchannel.WithOnDequeue(func(v T) {
+			f.record(func() { f.delivered = append(f.delivered, v) })
+		}),
+		unboundedchannel.WithOnClose(func(remaining int) {
+			f.record(func() { f.exited, f.remaining = true, remaining })
+		}),
+	)
+	f.in, f.out = unboundedchannel.NewWithOptions[T](ctx, opts...)
+
+	return f
+}
+
+// In returns the channel to which code under test writes.
+func (f *Fake[T]) In() chan<- T {
+	return f.in
+}
+
+// Out returns the channel from which code under test reads.
+func (f *Fake[T]) Out() <-chan T {
+	return f.out
+}
+
+// Script writes vs to In, for the consumer under test to read. It must not be called once In is closed.
+func (f *Fake[T]) Script(vs ...T) {
+	for _, v := range vs {
+		f.in <- v
+	}
+}
+
+// Close closes In, so Out is closed once the consumer under test read every message.
+func (f *Fake[T]) Close() {
+	close(f.in)
+}
+
+// Enqueued returns a copy of the messages buffered so far, in the order they were accepted.
+func (f *Fake[T]) Enqueued() []T {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]T(nil), f.enqueued...)
+}
+
+// Delivered returns a copy of the messages handed to the consumer so far, in the order they were delivered.
+func (f *Fake[T]) Delivered() []T {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]T(nil), f.delivered...)
+}
+
+// WaitEnqueued waits until at least n messages were buffered and returns them, failing the test if ctx is
+// done first.
+func (f *Fake[T]) WaitEnqueued(ctx context.Context, n int) []T {
+	f.t.Helper()
+
+	f.wait(ctx, func() bool { return len(f.enqueued) >= n }, "%d messages enqueued", n)
+	return f.Enqueued()
+}
+
+// WaitDelivered waits until at least n messages were delivered and returns them, failing the test if ctx is
+// done first.
+func (f *Fake[T]) WaitDelivered(ctx context.Context, n int) []T {
+	f.t.Helper()
+
+	f.wait(ctx, func() bool { return len(f.delivered) >= n }, "%d messages delivered", n)
+	return f.Delivered()
+}
+
+// AssertFIFO fails the test unless the messages were delivered in the order they were buffered, comparing
+// them with reflect.DeepEqual. It is only meaningful for FIFO buffers.
+func (f *Fake[T]) AssertFIFO() {
+	f.t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.delivered) > len(f.enqueued) {
+		f.t.Errorf("queuetest: %d messages delivered but only %d enqueued", len(f.delivered), len(f.enqueued))
+		return
+	}
+
+	for i, v := range f.delivered {
+		if !reflect.DeepEqual(v, f.enqueued[i]) {
+			f.t.Errorf("queuetest: message %d delivered is %v, want %v", i, v, f.enqueued[i])
+			return
+		}
+	}
+}
+
+// AssertClosed waits for the buffer to close Out, and fails the test unless it did so cleanly, with In closed
+// and every message delivered, or if ctx is done first.
+func (f *Fake[T]) AssertClosed(ctx context.Context) {
+	f.t.Helper()
+
+	f.wait(ctx, func() bool { return f.exited }, "Out to close")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.remaining > 0 {
+		f.t.Errorf("queuetest: Out closed with %d messages undelivered", f.remaining)
+	}
+}
+
+// record applies a change under the lock and wakes up waiters.
+func (f *Fake[T]) record(change func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	change()
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// wait blocks until done reports true, checked under the lock, failing the test with what it waited for if
+// ctx is done first.
+func (f *Fake[T]) wait(ctx context.Context, done func() bool, format string, args ...any) {
+	f.t.Helper()
+
+	for {
+		f.mu.Lock()
+		ok, changed := done(), f.changed
+		f.mu.Unlock()
+
+		if ok {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			f.t.Fatalf("queuetest: waiting for "+format+": %v", append(args, ctx.Err())...)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package unboundedchannel
+
+import "time"
+
+// limiter spaces out deliveries for WithRateLimit. It tracks when the bucket of burst tokens would be full
+// again given the deliveries so far, which is all a token bucket needs.
+type limiter struct {
+	interval time.Duration // Between two tokens
+	burst    int
+	full     time.Duration // Since the buffer started
+}
+
+// wait returns how long until a delivery is allowed at now.
+func (l *limiter) wait(now time.Duration) time.Duration {
+	return max(l.full-time.Duration(l.burst-1)*l.interval-now, 0)
+}
+
+// take spends a token on a delivery at now.
+func (l *limiter) take(now time.Duration) {
+	l.full = max(l.full, now) + l.interval
+}
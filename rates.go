@@ -0,0 +1,86 @@
+package unboundedchannel
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Rates are how many messages per second a buffer accepted and delivered over a recent window, as tracked
+// with WithRates.
+type Rates struct {
+	In     float64       // Messages accepted per second
+	Out    float64       // Messages delivered per second
+	Window time.Duration // Span the rates were measured over, shorter than WithRates' window while it fills up
+}
+
+// Lag returns how many more messages per second are accepted than delivered, so a positive Lag means the
+// buffer grows and consumers fall behind.
+func (r Rates) Lag() float64 {
+	return r.In - r.Out
+}
+
+// The window is split into this many slots, the oldest of which is replaced as time goes on
+const rateSlots = 10
+
+// rateSlot counts the messages of one slot of the window.
+type rateSlot struct {
+	index   atomic.Int64 // Slot of the whole timeline counted here, as time since the epoch divided by width
+	in, out atomic.Uint64
+}
+
+// rateMeter counts messages in slots of a rolling window, updated by the buffering goroutine and read by
+// anyone.
+type rateMeter struct {
+	width time.Duration
+	slots [rateSlots]rateSlot
+}
+
+func newRateMeter(window time.Duration) *rateMeter {
+	return &rateMeter{width: max(window/rateSlots, 1)}
+}
+
+// slot returns the slot counting now, clearing it first if it last counted an older part of the timeline.
+func (m *rateMeter) slot(now time.Duration) *rateSlot {
+	i := int64(now / m.width)
+	s := &m.slots[i%rateSlots]
+
+	if s.index.Load() != i {
+		s.in.Store(0)
+		s.out.Store(0)
+		s.index.Store(i)
+	}
+
+	return s
+}
+
+func (m *rateMeter) accepted(now time.Duration) {
+	m.slot(now).in.Add(1)
+}
+
+func (m *rateMeter) delivered(now time.Duration) {
+	m.slot(now).out.Add(1)
+}
+
+// rates sums the slots still in the window. Slots may be cleared concurrently, so the rates are approximate.
+func (m *rateMeter) rates(now time.Duration) Rates {
+	i := int64(now / m.width)
+
+	var in, out uint64
+	for j := range m.slots {
+		s := &m.slots[j]
+		if k := s.index.Load(); k <= i && k > i-rateSlots {
+			in += s.in.Load()
+			out += s.out.Load()
+		}
+	}
+
+	// The current slot is only partly elapsed, and the window can't reach back before the buffer was created
+	window := min(time.Duration(rateSlots-1)*m.width+now%m.width, now)
+	if window <= 0 {
+		return Rates{}
+	}
+
+	secs := window.Seconds()
+
+	return Rates{In: float64(in) / secs, Out: float64(out) / secs, Window: window}
+}
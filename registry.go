@@ -0,0 +1,76 @@
+package unboundedchannel
+
+import (
+	"slices"
+	"sync"
+)
+
+// Registry keeps track of live buffers by name, so operators can list them along with their statistics, for
+// example from a debug endpoint. Buffers join a registry with WithRegistry, and leave it once they stop.
+// Registry is safe for concurrent use.
+type Registry struct {
+	mu      sync.Mutex
+	buffers map[string]registered
+}
+
+// registered is the part of a buffer a Registry reads from, whatever its element type.
+type registered interface {
+	stats() Stats
+}
+
+// DefaultRegistry is the Registry buffers join with WithRegistry(nil).
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{buffers: make(map[string]registered)}
+}
+
+// Names returns the names of the live buffers in the registry, sorted.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.buffers))
+	for name := range r.buffers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// Stats returns a snapshot of the state and counters of the live buffer named name, or false if there is none.
+func (r *Registry) Stats(name string) (Stats, bool) {
+	r.mu.Lock()
+	b, ok := r.buffers[name]
+	r.mu.Unlock()
+
+	if !ok {
+		return Stats{}, false
+	}
+
+	return b.stats(), true
+}
+
+// add registers b under name, and panics if the name is taken by a live buffer.
+func (r *Registry) add(name string, b registered) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.buffers[name]; ok {
+		panic("unboundedchannel: Registry already has a buffer named " + name)
+	}
+
+	r.buffers[name] = b
+}
+
+// remove unregisters b, unless name was taken over since.
+func (r *Registry) remove(name string, b registered) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.buffers[name] == b {
+		delete(r.buffers, name)
+	}
+}
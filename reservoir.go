@@ -0,0 +1,72 @@
+package unboundedchannel
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+)
+
+// Reservoir keeps a uniform random sample of at most k of the messages it is given, however many there are,
+// for example to look at representative payloads of an unbounded stream. Reservoir is safe for concurrent use.
+// To sample a buffer without consuming its messages, pass Add to WithOnDequeue.
+type Reservoir[T any] struct {
+	mu     sync.Mutex
+	seen   uint64
+	sample []T
+}
+
+// NewReservoir returns an empty Reservoir holding at most k messages.
+// NewReservoir panics if k is less than 1.
+func NewReservoir[T any](k int) *Reservoir[T] {
+	if k < 1 {
+		panic("unboundedchannel: NewReservoir k must be positive")
+	}
+
+	return &Reservoir[T]{sample: make([]T, 0, k)}
+}
+
+// Add offers v to the sample, which keeps it with a probability of k over the number of messages seen so far.
+func (r *Reservoir[T]) Add(v T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seen++
+	if len(r.sample) < cap(r.sample) {
+		r.sample = append(r.sample, v)
+	} else if i := rand.Uint64N(r.seen); i < uint64(len(r.sample)) {
+		r.sample[i] = v
+	}
+}
+
+// Consume reads every message from out into the sample until it is closed, and returns nil, or ctx.Err() if
+// ctx is done first.
+func (r *Reservoir[T]) Consume(ctx context.Context, out <-chan T) error {
+	for {
+		select {
+		case v, ok := <-out:
+			if !ok {
+				return nil
+			}
+
+			r.Add(v)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Sample returns a copy of the messages currently in the sample, in no particular order.
+func (r *Reservoir[T]) Sample() []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]T(nil), r.sample...)
+}
+
+// Seen returns the number of messages offered to the sample so far.
+func (r *Reservoir[T]) Seen() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.seen
+}
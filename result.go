@@ -0,0 +1,74 @@
+package unboundedchannel
+
+import "context"
+
+// Result carries a value or the error that prevented producing it, so a single channel can carry both data
+// and per-message errors through a pipeline.
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// Ok returns a successful Result holding v.
+func Ok[T any](v T) Result[T] {
+	return Result[T]{Value: v}
+}
+
+// Fail returns a failed Result holding err.
+func Fail[T any](err error) Result[T] {
+	return Result[T]{Err: err}
+}
+
+// Get returns the value and error of r.
+func (r Result[T]) Get() (T, error) {
+	return r.Value, r.Err
+}
+
+// NewMapResult returns a pair of channels (in, out) like NewMap, except that fn may fail and out carries
+// the outcome of each conversion as a Result.
+func NewMapResult[In, Out any](ctx context.Context, fn func(In) (Out, error), opts ...Option) (chan<- In, <-chan Result[Out]) {
+	return NewMap(ctx, func(v In) Result[Out] {
+		out, err := fn(v)
+		return Result[Out]{Value: out, Err: err}
+	}, opts...)
+}
+
+// Split separates the values of successful results read from in from the errors of failed ones.
+// Both outputs are buffered like NewWithContext, so a consumer that only drains one of them never holds up
+// the other. Both are closed once in is closed and they drain, or once ctx is done.
+func Split[T any](ctx context.Context, in <-chan Result[T]) (values <-chan T, errs <-chan error) {
+	vb := start[T](ctx, nil)
+	eb := start[error](ctx, nil)
+
+	go func() {
+		defer close(vb.in)
+		defer close(eb.in)
+
+		for {
+			select {
+			case r, ok := <-in:
+				if !ok {
+					return
+				}
+
+				if r.Err != nil {
+					select {
+					case eb.in <- r.Err:
+					case <-eb.done:
+						return
+					}
+				} else {
+					select {
+					case vb.in <- r.Value:
+					case <-vb.done:
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return vb.out, eb.out
+}
@@ -0,0 +1,92 @@
+package unboundedchannel
+
+import "math/bits"
+
+// minRingSize is the capacity a ring starts with on the first push.
+const minRingSize = 16
+
+// ring is a FIFO backed by a circular slice that doubles when full.
+// It never reslices, and by default never shrinks, so a buffer with a roughly steady depth reaches its
+// working size once and stops allocating. Its capacity is always a power of two.
+type ring[T any] struct {
+	items   []T
+	head, n int
+
+	floor  int          // Capacity to never shrink below
+	shrink ShrinkPolicy // nil means never shrink
+}
+
+// newRing returns an empty ring with room for at least capacity messages, which is shrunk according to
+// shrink but never below capacity.
+func newRing[T any](capacity int, shrink ShrinkPolicy) *ring[T] {
+	r := &ring[T]{shrink: shrink}
+	if capacity > 0 {
+		r.floor = max(minRingSize, nextPowerOfTwo(capacity))
+		r.items = make([]T, r.floor)
+	}
+
+	return r
+}
+
+// nextPowerOfTwo returns the smallest power of two that is at least n, for n > 0.
+func nextPowerOfTwo(n int) int {
+	return 1 << bits.Len(uint(n-1))
+}
+
+func (r *ring[T]) len() int {
+	return r.n
+}
+
+func (r *ring[T]) push(v T) {
+	if r.n == len(r.items) {
+		r.resize(max(2*len(r.items), minRingSize))
+	}
+
+	r.items[(r.head+r.n)&(len(r.items)-1)] = v
+	r.n++
+}
+
+// peek returns the head message. The ring must not be empty.
+func (r *ring[T]) peek() T {
+	return r.items[r.head]
+}
+
+// pop removes and returns the head message. The ring must not be empty.
+func (r *ring[T]) pop() T {
+	v := r.items[r.head]
+	r.items[r.head] = *new(T)
+	r.head = (r.head + 1) & (len(r.items) - 1)
+	r.n--
+
+	if r.shrink != nil && len(r.items) > r.floor && r.shrink(r.n, len(r.items)) {
+		// Shrink to the smallest size that holds the rest
+		size := r.floor
+		if r.n > 0 {
+			size = max(size, minRingSize, nextPowerOfTwo(r.n))
+		}
+
+		if size < len(r.items) {
+			r.resize(size)
+		}
+	}
+
+	return v
+}
+
+// resize moves the messages to a new slice of the given capacity, which must hold them all.
+// A size of 0 releases the slice entirely.
+func (r *ring[T]) resize(size int) {
+	var items []T
+	if size > 0 {
+		items = make([]T, size)
+	}
+
+	// Copy the wrapped-around messages back in order
+	if r.n > 0 {
+		n := copy(items, r.items[r.head:min(r.head+r.n, len(r.items))])
+		copy(items[n:], r.items[:r.n-n])
+	}
+
+	r.items = items
+	r.head = 0
+}
@@ -0,0 +1,63 @@
+package unboundedchannel
+
+import (
+	"context"
+	"testing"
+)
+
+// BenchmarkStore keeps a steady depth of messages in the bare stores, pushing and popping in bursts, which is
+// where the ring stops allocating once it reached its working size.
+func BenchmarkStore(b *testing.B) {
+	stores := []struct {
+		name string
+		new  func() store[int]
+	}{
+		{"chunks", func() store[int] { return newChunkList[int](0, nil) }},
+		{"ring", func() store[int] { return newRing[int](0, nil) }},
+	}
+
+	for _, s := range stores {
+		b.Run(s.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			st := s.new()
+			for i := 0; i < b.N; i++ {
+				for j := range 1000 {
+					st.push(j)
+				}
+				for range 1000 {
+					st.pop()
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRingBuffer moves bursts of messages through a buffer, with the default chunks and WithRingBuffer.
+func BenchmarkRingBuffer(b *testing.B) {
+	options := []struct {
+		name string
+		opts []Option
+	}{
+		{"chunks", nil},
+		{"ring", []Option{WithRingBuffer()}},
+	}
+
+	for _, o := range options {
+		b.Run(o.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			in, out := NewWithOptions[int](context.Background(), o.opts...)
+			defer close(in)
+
+			for i := 0; i < b.N; i++ {
+				for j := range 1000 {
+					in <- j
+				}
+				for range 1000 {
+					<-out
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package unboundedchannel
+
+import (
+	"cmp"
+	"context"
+	"strconv"
+	"time"
+)
+
+// Scale is the advice of a ScaleEvent.
+type Scale int
+
+const (
+	// ScaleUp advises adding a consumer: the queue kept growing because messages come in faster than they
+	// are delivered.
+	ScaleUp Scale = iota + 1
+
+	// ScaleDown advises removing a consumer: the queue stayed empty, so consumers keep up with room to spare.
+	ScaleDown
+)
+
+// String returns the name of the advice.
+func (s Scale) String() string {
+	switch s {
+	case ScaleUp:
+		return "ScaleUp"
+	case ScaleDown:
+		return "ScaleDown"
+	default:
+		return "Scale(" + strconv.Itoa(int(s)) + ")"
+	}
+}
+
+// ScaleEvent is sent by Queue.Scaling when a trend lasted long enough to act on.
+type ScaleEvent struct {
+	Scale Scale
+	Rates Rates // Rates at the last check
+	Len   int   // Messages buffered at the last check
+}
+
+// ScalePolicy sets when Queue.Scaling sends a ScaleEvent.
+type ScalePolicy struct {
+	Interval time.Duration // How often the rates are checked, 1s if zero
+	Sustain  int           // Consecutive checks a trend must last for before it is sent, 3 if zero
+	MinLag   float64       // Messages per second the queue must grow by for ScaleUp, any growth if zero
+}
+
+// Scaling returns a channel of advice for a pool of consumers of the queue, based on the rates tracked with
+// WithRates. It checks them every policy.Interval, and sends ScaleUp once the queue was not empty and grew for
+// policy.Sustain checks in a row, or ScaleDown once it was empty for as many, then starts counting again.
+// Events are advisory: one is skipped if the previous one wasn't received yet. The channel is closed once ctx
+// is done or the queue's buffering goroutine has exited.
+// Scaling panics if the queue wasn't created with WithRates.
+func (q *Queue[T]) Scaling(ctx context.Context, policy ScalePolicy) <-chan ScaleEvent {
+	if q.b.meter == nil {
+		panic("unboundedchannel: Scaling requires WithRates")
+	}
+
+	interval, sustain := cmp.Or(policy.Interval, time.Second), cmp.Or(policy.Sustain, 3)
+	events := make(chan ScaleEvent, 1)
+
+	go func() {
+		defer close(events)
+
+		timer := q.b.clock.NewTimer(interval)
+		defer timer.Stop()
+
+		var trend Scale
+		var streak int
+		for {
+			select {
+			case <-timer.C():
+				timer.Reset(interval)
+			case <-q.b.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+
+			rates, n := q.Rates(), q.Len()
+
+			var now Scale
+			switch {
+			case n > 0 && rates.Lag() > policy.MinLag:
+				now = ScaleUp
+			case n == 0:
+				now = ScaleDown
+			}
+
+			if now != trend {
+				trend, streak = now, 0
+			}
+			if now == 0 {
+				continue
+			}
+
+			if streak++; streak < sustain {
+				continue
+			}
+			streak = 0
+
+			select {
+			case events <- ScaleEvent{Scale: now, Rates: rates, Len: n}:
+			default:
+			}
+		}
+	}()
+
+	return events
+}
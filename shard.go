@@ -0,0 +1,49 @@
+package unboundedchannel
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// NewSharded returns n input channels, each with its own buffer and goroutine configured by opts, all
+// delivering to one output channel. Producers spread across the inputs, for example by hashing a key or
+// picking one per producer, so that writes scale across cores instead of contending on a single channel.
+// The buffers take turns delivering while the consumer is slower than them.
+//
+// Ordering is relaxed: messages written to the same input stay in order, but there is no order between
+// messages written to different inputs. Options apply to each buffer on its own, so WithCapacity bounds each
+// input rather than the total, and the names set by WithName and WithExpvar get the index of each input
+// appended, as name/0, name/1 and so on, so every buffer is listed on its own. out is closed once every input
+// is closed and its buffer drained, or ctx is done.
+// NewSharded panics if n is less than 1.
+func NewSharded[T any](ctx context.Context, n int, opts ...Option) (ins []chan<- T, out <-chan T) {
+	if n < 1 {
+		panic("unboundedchannel: NewSharded n must be positive")
+	}
+
+	shards := make([]*buffer[T, T], n)
+	for i := range shards {
+		shards[i] = newBuffer(ctx, append(opts[:len(opts):len(opts)], withSuffix("/"+strconv.Itoa(i))), identity[T])
+	}
+
+	// Deliver through a single channel, closed once the last buffer exits
+	shared := make(chan T, shards[0].opts.outBuffer)
+
+	var wg sync.WaitGroup
+	ins = make([]chan<- T, n)
+	for i, b := range shards {
+		b.out, b.outs, b.closeOut = shared, []chan T{shared}, wg.Done
+		ins[i] = b.in
+
+		wg.Add(1)
+		go b.run()
+	}
+
+	go func() {
+		wg.Wait()
+		close(shared)
+	}()
+
+	return ins, shared
+}
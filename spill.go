@@ -0,0 +1,251 @@
+package unboundedchannel
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// spill is a FIFO that keeps up to threshold messages in memory, and writes the rest to a temporary file,
+// reading them back in order as the memory empties. While the file holds messages, new ones are appended to it
+// to keep them in order, so memory only holds the oldest messages.
+type spill[T any] struct {
+	mem       *chunkList[elem[T]]
+	threshold int
+	dir       string
+	codec     Codec[T]
+	log       *slog.Logger // Disk errors are logged with WithLogger, if set
+
+	file   *os.File
+	w      *bufio.Writer
+	r      *bufio.Reader // Reads records back from the start of the file, while w appends to it
+	tail   *tailReader   // What r reads from
+	onDisk int
+	failed bool // Stop spilling after a write error, keeping messages in memory instead
+}
+
+func newSpill[T any](dir string, threshold int, codec Codec[T], o *options) *spill[T] {
+	return &spill[T]{
+		mem:       newChunkList[elem[T]](o.initialCapacity, o.shrink),
+		threshold: threshold,
+		dir:       dir,
+		codec:     codec,
+		log:       o.logger,
+	}
+}
+
+func (s *spill[T]) len() int {
+	return s.mem.len() + s.onDisk
+}
+
+func (s *spill[T]) push(e elem[T]) {
+	if !s.failed && (s.onDisk > 0 || s.mem.len() >= s.threshold) {
+		err := s.write(e)
+		if err == nil {
+			s.onDisk++
+			return
+		}
+
+		s.fail("unboundedchannel: spilling to disk failed, keeping messages in memory", err)
+
+		// Messages already on disk were written before this one, so read them all back first
+		s.failed = true
+		s.load(s.onDisk)
+	}
+
+	s.mem.push(e)
+}
+
+func (s *spill[T]) peek() elem[T] {
+	if s.mem.len() == 0 {
+		s.load(chunkSize)
+	}
+
+	return s.mem.peek()
+}
+
+func (s *spill[T]) pop() elem[T] {
+	if s.mem.len() == 0 {
+		s.load(chunkSize)
+	}
+
+	return s.mem.pop()
+}
+
+// write appends e to the file, creating it if needed.
+func (s *spill[T]) write(e elem[T]) error {
+	if s.file == nil {
+		f, err := os.CreateTemp(s.dir, "unboundedchannel-spill-*")
+		if err != nil {
+			return err
+		}
+
+		s.file, s.w = f, bufio.NewWriter(f)
+		s.tail = &tailReader{f: f}
+		s.r = bufio.NewReader(s.tail)
+	}
+
+	data, err := s.codec.Encode(e.v)
+	if err != nil {
+		return err
+	}
+
+	var header [3 * binary.MaxVarintLen64]byte
+	n := binary.PutVarint(header[:], int64(e.at))
+	n += binary.PutUvarint(header[n:], uint64(e.attempts))
+	n += binary.PutUvarint(header[n:], uint64(len(data)))
+
+	if _, err := s.w.Write(header[:n]); err != nil {
+		return err
+	}
+
+	_, err = s.w.Write(data)
+	return err
+}
+
+// load reads up to n messages back from the file into memory. Messages that can't be read back are lost, since
+// those after them can't be found either.
+func (s *spill[T]) load(n int) {
+	if s.onDisk == 0 {
+		return
+	}
+
+	if err := s.w.Flush(); err != nil {
+		s.fail("unboundedchannel: flushing spilled messages failed, they are lost", err)
+		s.lose()
+		return
+	}
+
+	for i := 0; i < n && s.onDisk > 0; i++ {
+		e, err := s.read(s.r)
+		if err != nil {
+			s.fail("unboundedchannel: reading spilled messages back failed, they are lost", err)
+			s.lose()
+			return
+		}
+
+		s.mem.push(e)
+		s.onDisk--
+	}
+
+	// Start over once everything was read back, so the file doesn't grow forever
+	if s.onDisk == 0 {
+		s.close()
+	}
+}
+
+// walk goes through the messages in memory, then reads those on disk back with a reader of its own, so loading
+// them later starts where it left off. The file is only read if fn wants more than memory holds. Messages that
+// can't be read back are left out.
+func (s *spill[T]) walk(fn func(elem[T]) bool) bool {
+	if !s.mem.walk(fn) {
+		return false
+	}
+	if s.onDisk == 0 {
+		return true
+	}
+
+	if err := s.w.Flush(); err != nil {
+		s.fail("unboundedchannel: flushing spilled messages failed", err)
+		return true
+	}
+
+	r := bufio.NewReader(&tailReader{f: s.file, off: s.tail.off - int64(s.r.Buffered())})
+	for range s.onDisk {
+		e, err := s.read(r)
+		if err != nil {
+			s.fail("unboundedchannel: reading spilled messages failed", err)
+			return true
+		}
+
+		if !fn(e) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *spill[T]) walkable() bool {
+	return true
+}
+
+// read decodes the next record from the file through r.
+func (s *spill[T]) read(r *bufio.Reader) (elem[T], error) {
+	at, err := binary.ReadVarint(r)
+	if err != nil {
+		return elem[T]{}, err
+	}
+
+	attempts, err := binary.ReadUvarint(r)
+	if err != nil {
+		return elem[T]{}, err
+	}
+
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return elem[T]{}, err
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return elem[T]{}, err
+	}
+
+	v, err := s.codec.Decode(data)
+	if err != nil {
+		return elem[T]{}, err
+	}
+
+	return elem[T]{v: v, at: time.Duration(at), attempts: int(attempts)}, nil
+}
+
+// lose gives up on the messages left in the file.
+func (s *spill[T]) lose() {
+	s.onDisk = 0
+	s.close()
+}
+
+// fail logs a disk error, if WithLogger is set.
+func (s *spill[T]) fail(msg string, err error) {
+	if s.log != nil {
+		s.log.Error(msg, "err", err)
+	}
+}
+
+// close removes the file, if any. It is called as the buffer exits, and whenever the file is emptied.
+func (s *spill[T]) close() {
+	if s.file == nil {
+		return
+	}
+
+	name := s.file.Name()
+	err := errors.Join(s.file.Close(), os.Remove(name))
+	if err != nil {
+		s.fail("unboundedchannel: removing spill file failed", err)
+	}
+
+	s.file, s.w, s.r, s.tail = nil, nil, nil, nil
+}
+
+// tailReader reads a file from the start while it is being appended to. Unlike an io.SectionReader, it doesn't
+// report io.EOF along with data, which bufio.Reader would keep returning even after the file grows.
+type tailReader struct {
+	f   *os.File
+	off int64
+}
+
+func (r *tailReader) Read(p []byte) (int, error) {
+	n, err := r.f.ReadAt(p, r.off)
+	r.off += int64(n)
+
+	if n > 0 {
+		return n, nil
+	}
+
+	return 0, err
+}
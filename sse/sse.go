@@ -0,0 +1,159 @@
+// Package sse streams the messages of an unboundedchannel buffer to HTTP clients as Server-Sent Events, for
+// example to feed live dashboards.
+//
+// Every request gets its own subscription to a Broadcaster, buffered according to the options given to the
+// Handler, so a slow client falls behind on its own and what it misses is set by the overflow policy:
+//
+//	h := sse.New(ctx, out, unboundedchannel.JSONCodec[Update]{},
+//		unboundedchannel.WithCapacity(100), unboundedchannel.WithOverflow(unboundedchannel.DropOldest))
+//	mux.Handle("/updates", h)
+package sse
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/launch-lab-public/unboundedchannel"
+)
+
+// Handler is an http.Handler that streams every message published to a Broadcaster to each request, as the
+// data of an event. Its fields must be set before it serves requests.
+type Handler[T any] struct {
+	// Event is the type of the events sent, or the default "message" if empty
+	Event string
+
+	// Heartbeat is how often a comment is sent while there is no message, so proxies keep idle connections
+	// open, or never if zero
+	Heartbeat time.Duration
+
+	// Clock times heartbeats, or unboundedchannel.SystemClock if nil
+	Clock unboundedchannel.Clock
+
+	// WriteTimeout disconnects a client that takes longer than this to accept an event, if not zero and the
+	// server supports write deadlines
+	WriteTimeout time.Duration
+
+	b     *unboundedchannel.Broadcaster[T]
+	codec unboundedchannel.Codec[T]
+	opts  []unboundedchannel.Option
+}
+
+// NewHandler returns a Handler streaming the messages of b, encoded with codec. opts configure the buffer of
+// each request's subscription, see Broadcaster.Subscribe.
+func NewHandler[T any](b *unboundedchannel.Broadcaster[T], codec unboundedchannel.Codec[T], opts ...unboundedchannel.Option) *Handler[T] {
+	return &Handler[T]{b: b, codec: codec, opts: opts}
+}
+
+// New returns a Handler like NewHandler, streaming the messages read from out through a Broadcaster of its
+// own, which is closed once out is closed, ending every request after its last messages.
+// The provided ctx is used to stop the Broadcaster early.
+func New[T any](ctx context.Context, out <-chan T, codec unboundedchannel.Codec[T], opts ...unboundedchannel.Option) *Handler[T] {
+	b := unboundedchannel.NewBroadcaster[T](ctx)
+
+	go func() {
+		defer b.Close()
+
+		for {
+			select {
+			case v, ok := <-out:
+				if !ok {
+					return
+				}
+
+				b.Publish(ctx, v)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return NewHandler(b, codec, opts...)
+}
+
+// ServeHTTP streams events until the client goes away, or the Broadcaster is closed and the subscription
+// drained.
+func (h *Handler[T]) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return // Streaming not supported
+	}
+
+	sub, cancel := h.b.Subscribe(h.opts...)
+	defer cancel()
+
+	var heartbeat unboundedchannel.Timer
+	var beat <-chan time.Time
+	if h.Heartbeat > 0 {
+		clock := h.Clock
+		if clock == nil {
+			clock = unboundedchannel.SystemClock
+		}
+
+		heartbeat = clock.NewTimer(h.Heartbeat)
+		defer heartbeat.Stop()
+
+		beat = heartbeat.C()
+	}
+
+	var buf bytes.Buffer
+	for {
+		buf.Reset()
+
+		select {
+		case v, ok := <-sub:
+			if !ok {
+				return
+			}
+
+			data, err := h.codec.Encode(v)
+			if err != nil {
+				fmt.Fprintf(&buf, ": encoding message: %v\n\n", err)
+				break
+			}
+
+			writeEvent(&buf, h.Event, data)
+		case <-beat:
+			buf.WriteString(":\n\n")
+		case <-req.Context().Done():
+			return
+		}
+
+		if h.WriteTimeout > 0 {
+			rc.SetWriteDeadline(time.Now().Add(h.WriteTimeout))
+		}
+
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		// Whatever was just sent keeps the connection busy, so the next heartbeat is a full period away
+		if heartbeat != nil {
+			heartbeat.Reset(h.Heartbeat)
+		}
+	}
+}
+
+// writeEvent formats an event of type event carrying data, one data field per line.
+func writeEvent(buf *bytes.Buffer, event string, data []byte) {
+	if event != "" {
+		fmt.Fprintf(buf, "event: %s\n", event)
+	}
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(bytes.TrimSuffix(line, []byte("\r")))
+		buf.WriteByte('\n')
+	}
+
+	buf.WriteByte('\n')
+}
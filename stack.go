@@ -0,0 +1,47 @@
+package unboundedchannel
+
+// stack is a LIFO backed by a slice.
+// Like ring, it keeps the largest size it has reached unless a ShrinkPolicy says otherwise.
+type stack[T any] struct {
+	items []T
+
+	floor  int
+	shrink ShrinkPolicy
+}
+
+func newStack[T any](capacity int, shrink ShrinkPolicy) *stack[T] {
+	return &stack[T]{
+		items:  make([]T, 0, capacity),
+		floor:  capacity,
+		shrink: shrink,
+	}
+}
+
+func (s *stack[T]) len() int {
+	return len(s.items)
+}
+
+func (s *stack[T]) push(v T) {
+	s.items = append(s.items, v)
+}
+
+// peek returns the most recently pushed message. The stack must not be empty.
+func (s *stack[T]) peek() T {
+	return s.items[len(s.items)-1]
+}
+
+// pop removes and returns the most recently pushed message. The stack must not be empty.
+func (s *stack[T]) pop() T {
+	n := len(s.items) - 1
+	v := s.items[n]
+	s.items[n] = *new(T)
+	s.items = s.items[:n]
+
+	if s.shrink != nil && cap(s.items) > s.floor && s.shrink(n, cap(s.items)) {
+		items := make([]T, n, max(n, s.floor))
+		copy(items, s.items)
+		s.items = items
+	}
+
+	return v
+}
@@ -0,0 +1,103 @@
+package unboundedchannel
+
+import "time"
+
+// elem is a message as kept in a store, along with when it was written.
+type elem[T any] struct {
+	v  T
+	at time.Duration // Since the buffer started, only set when a feature needs it
+
+	attempts int // Deliveries so far, only counted by WithAck
+}
+
+// store is the container a buffer keeps its messages in.
+// peek and pop must only be called on a non-empty store.
+type store[T any] interface {
+	len() int
+	push(v T)
+	peek() T
+	pop() T
+}
+
+// closer is implemented by stores that hold resources beyond memory, released by close as the buffer exits.
+type closer interface {
+	close()
+}
+
+// failing is implemented by stores that can fail to keep their messages, such as the log of NewDurableQueue.
+// The buffer stops with the error failure returns.
+type failing interface {
+	failure() error
+}
+
+// retainer is implemented by stores that persist their messages, so those left undelivered as the buffer
+// exits are kept by retain rather than recorded as popped.
+type retainer interface {
+	retain()
+}
+
+// folding is implemented by stores that fold a pushed message into a pending one with the same key, which
+// report through folds whether v would be, so it takes no room from the others. Decorators forward it.
+type folding[T any] interface {
+	folds(v T) bool
+}
+
+// folds reports whether s would fold v into a pending message rather than add it.
+func folds[T any](s store[T], v T) bool {
+	f, ok := s.(folding[T])
+	return ok && f.folds(v)
+}
+
+// walker is implemented by stores that can go through their messages in delivery order without removing them,
+// so a snapshot doesn't pop and push back each one, which the logs of NewDurableQueue and WithSpill would
+// record. walk stops as soon as fn returns false, and reports whether it went through every message.
+// Decorators implement it for any store, and report through walkable whether the one they wrap can.
+type walker[T any] interface {
+	walkable() bool
+	walk(fn func(T) bool) bool
+}
+
+// canWalk reports whether s can go through its messages without removing them.
+func canWalk[T any](s store[T]) bool {
+	w, ok := s.(walker[T])
+	return ok && w.walkable()
+}
+
+// backing selects the store implementation used by a buffer.
+type backing int
+
+const (
+	chunked backing = iota // chunkList, the default
+	ringed                 // ring
+	stacked                // stack
+	typed                  // Built by options.typed
+)
+
+// newStore returns an empty store of the configured backing.
+func newStore[T any](o *options) store[elem[T]] {
+	switch o.backing {
+	case typed:
+		return typedFunc[func(*options) store[elem[T]]](o.typed, o.typedOption)(o)
+	case stacked:
+		return newStack[elem[T]](o.initialCapacity, o.shrink)
+	case ringed:
+		return newRing[elem[T]](o.initialCapacity, o.shrink)
+	default:
+		return newChunkList[elem[T]](o.initialCapacity, o.shrink)
+	}
+}
+
+// typedFunc returns f, set by the named option from an element-typed func, as an F.
+// It returns the zero F if f is nil, and panics if the element types don't match.
+func typedFunc[F any](f any, option string) F {
+	if f == nil {
+		return *new(F)
+	}
+
+	typed, ok := f.(F)
+	if !ok {
+		panic("unboundedchannel: " + option + " does not match the element type")
+	}
+
+	return typed
+}
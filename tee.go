@@ -0,0 +1,50 @@
+package unboundedchannel
+
+import "context"
+
+// Tee returns n channels that each receive every message from in, through independent buffers like
+// NewWithContext, so a slow consumer of one copy never holds up the others.
+// Every output is closed once in is closed and that output drains, or once ctx is done.
+// Tee panics if n is less than 1.
+func Tee[T any](ctx context.Context, in <-chan T, n int) []<-chan T {
+	if n < 1 {
+		panic("unboundedchannel: Tee n must be positive")
+	}
+
+	bufs := make([]*buffer[T, T], n)
+	outs := make([]<-chan T, n)
+	for i := range bufs {
+		bufs[i] = start[T](ctx, nil)
+		outs[i] = bufs[i].out
+	}
+
+	// Copy each message to every buffer
+	go func() {
+		defer func() {
+			for _, b := range bufs {
+				close(b.in)
+			}
+		}()
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+
+				for _, b := range bufs {
+					select {
+					case b.in <- v:
+					case <-b.done:
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return outs
+}
@@ -1,16 +1,19 @@
 package unboundedchannel
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
-// New returns a pair of channels (in, out) that implement an unbounded FIFO using a slice as the buffer.
+// New returns a pair of channels (in, out) that implement an unbounded FIFO using a linked list of fixed-size chunks as the buffer.
 // Writes to in never block; reads from out block only if the buffer is empty and in is not closed.
 // The caller must close in to eventually close out, and must drain out to fully release resources.
-// Failing to close in or drain out after closing in leaks a goroutine.
+// Failing to close in or drain out after closing in leaks a goroutine.
 func New[T any]() (chan<- T, <-chan T) {
 	return NewWithContext[T](context.Background())
 }
 
-// NewWithContext returns a pair of channels (in, out) that implement an unbounded FIFO using a slice as the buffer.
+// NewWithContext returns a pair of channels (in, out) that implement an unbounded FIFO using a linked list of fixed-size chunks as the buffer.
 // Writes to in never block (unless context is done); reads from out block only if the buffer is empty and in is not closed.
 // The provided ctx is used to cancel any pending operations and terminate buffering early.
 // The caller must either cancel the context or close in to eventually close out, and must drain out to fully release resources.
@@ -26,62 +29,82 @@ func New[T any]() (chan<- T, <-chan T) {
 //	    // Write dropped due to context cancellation
 //	}
 func NewWithContext[T any](ctx context.Context) (chan<- T, <-chan T) {
-	in := make(chan T)
-	out := make(chan T)
+	return NewWithOptions[T](ctx)
+}
 
-	// Start buffering
-	go buffer(ctx, in, out)
+// NewWithOptions returns a pair of channels (in, out) that implement a FIFO like NewWithContext,
+// configured by opts. Without any options it behaves exactly like NewWithContext.
+func NewWithOptions[T any](ctx context.Context, opts ...Option) (chan<- T, <-chan T) {
+	b := start[T](ctx, opts)
+	return b.in, b.out
+}
 
-	return in, out
+// NewBounded returns a pair of channels (in, out) that implement a FIFO like NewWithContext,
+// except that the buffer holds at most max elements.
+// Once the buffer is full, writes to in block until the consumer reads from out.
+// NewBounded panics if max is less than 1.
+func NewBounded[T any](ctx context.Context, max int) (chan<- T, <-chan T) {
+	return NewWithOptions[T](ctx, WithCapacity(max))
 }
 
-func buffer[T any](ctx context.Context, in <-chan T, out chan<- T) {
-	defer close(out)
+// NewDropOldest returns a pair of channels (in, out) that implement a FIFO like NewWithContext,
+// except that the buffer holds at most max elements.
+// Once the buffer is full, each write to in discards the oldest buffered element, so writes never block
+// and the consumer always sees the most recent max elements.
+// NewDropOldest panics if max is less than 1.
+func NewDropOldest[T any](ctx context.Context, max int) (chan<- T, <-chan T) {
+	return NewWithOptions[T](ctx, WithCapacity(max), WithOverflow(DropOldest))
+}
 
-	var buffer []T
+// NewDropNewest returns a pair of channels (in, out) that implement a FIFO like NewWithContext,
+// except that the buffer holds at most max elements.
+// Once the buffer is full, writes to in are accepted but silently discarded until the consumer makes room,
+// so writes never block. The returned dropped func reports how many elements have been discarded so far
+// and is safe to call concurrently, including after out is closed.
+// NewDropNewest panics if max is less than 1.
+func NewDropNewest[T any](ctx context.Context, max int) (in chan<- T, out <-chan T, dropped func() uint64) {
+	b := start[T](ctx, []Option{WithCapacity(max), WithOverflow(DropNewest)})
+	return b.in, b.out, b.dropped.Load
+}
 
-	// Outer loop only adds to buffer
-loop:
-	for {
-		select {
-		case t, ok := <-in:
-			if !ok {
-				return // Buffer is empty here
-			}
+// NewPriority returns a pair of channels (in, out) like NewWithContext, except that out delivers the buffered
+// messages in priority order: a message a is delivered before b if less(a, b).
+// Messages of equal priority are delivered in the order they were written to in.
+func NewPriority[T any](ctx context.Context, less func(a, b T) bool) (chan<- T, <-chan T) {
+	return NewWithOptions[T](ctx, WithPriority(less))
+}
 
-			buffer = append(buffer, t)
+// NewDelayed returns a pair of channels (in, out) like NewWithContext, except that each message is held
+// until the time returned by due and messages are delivered in order of that time.
+// It can stand in for a timer wheel, for example to schedule retries.
+func NewDelayed[T any](ctx context.Context, due func(T) time.Time) (chan<- T, <-chan T) {
+	return NewWithOptions[T](ctx, WithDeliverAt(due))
+}
+
+// NewMap returns a pair of channels (in, out) like NewWithOptions, except that each message written to in is
+// converted with fn by the buffering goroutine itself, saving a goroutine and a channel hop per stage.
+// fn runs as messages are buffered, in order, and must not block. opts apply to the converted messages.
+func NewMap[In, Out any](ctx context.Context, fn func(In) Out, opts ...Option) (chan<- In, <-chan Out) {
+	b := startConv(ctx, opts, func(v In) (Out, bool) { return fn(v), true })
+	return b.in, b.out
+}
 
-			// Inner loop both adds to buffer and writes to out
-			for len(buffer) > 0 {
-				select {
-				case t, ok := <-in:
-					// When in is closed, exit loop
-					if !ok {
-						break loop
-					}
+// NewFilter returns a pair of channels (in, out) like NewWithOptions, except that the buffering goroutine
+// discards every message for which keep returns false. The returned filtered func reports how many messages
+// have been discarded so far and is safe to call concurrently, including after out is closed.
+func NewFilter[T any](ctx context.Context, keep func(T) bool, opts ...Option) (in chan<- T, out <-chan T, filtered func() uint64) {
+	b := start[T](ctx, append(opts[:len(opts):len(opts)], WithFilter(keep)))
+	return b.in, b.out, b.filtered.Load
+}
 
-					buffer = append(buffer, t)
-				case out <- buffer[0]:
-					buffer[0] = *new(T)
-					buffer = buffer[1:]
-				case <-ctx.Done():
-					return
-				}
-			}
+// Buffer returns the output of a buffer configured by opts that reads directly from in, a channel the caller
+// doesn't own, such as one returned by another library. out is closed once in is closed and the buffer
+// drained, or ctx is done.
+func Buffer[T any](ctx context.Context, in <-chan T, opts ...Option) <-chan T {
+	b := newBuffer(ctx, opts, identity[T])
+	b.src = in
 
-			// Release buffer everytime it's emptied
-			buffer = nil
-		case <-ctx.Done():
-			return
-		}
-	}
+	go b.run()
 
-	// Write out rest of the messages to out before exit
-	for _, t := range buffer {
-		select {
-		case out <- t:
-		case <-ctx.Done():
-			return
-		}
-	}
+	return b.out
 }
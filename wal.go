@@ -0,0 +1,370 @@
+package unboundedchannel
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// walSegmentSize is the size past which the WAL of a durable queue starts a new segment file, so segments whose
+// messages have all been delivered can be deleted. It is a variable so tests can roll segments quickly, read
+// as each WAL opens.
+var walSegmentSize int64 = 64 << 20
+
+// WAL record types
+const (
+	walPush = 'P' // Followed by the length of the encoded message, and the message
+	walPop  = 'A' // Followed by the number of messages delivered since the WAL was created
+)
+
+// wal is the FIFO of a durable queue. It logs every message pushed and the number popped to segment files in
+// dir, so a later NewDurableQueue on dir can restore the messages that were not delivered.
+type wal[T any] struct {
+	mem   *chunkList[elem[T]]
+	dir   string
+	codec Codec[T]
+
+	segments []uint64 // Index of the first message of each segment, oldest first
+	file     *os.File // The last segment, which records are appended to
+	w        *bufio.Writer
+	size     int64
+	maxSize  int64 // walSegmentSize as the WAL opened
+
+	pushed, popped uint64 // Since the WAL was created
+	dirty          bool   // Whether pushes were written since the last sync
+	replaying      bool   // Whether pushes come from the WAL itself, and are not logged again
+	retained       bool   // Whether the buffer exits, so pops are no longer logged
+	err            error  // The first write error, after which the WAL stops the buffer
+}
+
+// NewDurableQueue returns a Queue like NewQueue that logs its messages to a write-ahead log in dir, encoded with
+// codec, so they survive a crash or restart: each message is written and synced to disk before it is delivered,
+// and messages not yet delivered when the process stopped are restored by the next NewDurableQueue on dir, in
+// order. Segments of the log are deleted once all their messages have been delivered.
+// The queue is always a FIFO, so options selecting another store, such as WithPriority, are ignored.
+// A message is logged as delivered once it leaves the queue, before any acknowledgement, so NewDurableQueue
+// panics with WithAck rather than lose unacknowledged messages on a restart. The log only appends messages at
+// the back, so Queue.PushFront returns ErrPushFront.
+// If the log can't be written, the queue stops and Err returns the error.
+// NewDurableQueue returns an error if dir can't be created or its log can't be read.
+func NewDurableQueue[T any](ctx context.Context, dir string, codec Codec[T], opts ...Option) (*Queue[T], error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.visibility > 0 {
+		panic("unboundedchannel: NewDurableQueue doesn't support WithAck")
+	}
+
+	w, restored, err := openWAL(dir, codec)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts[:len(opts):len(opts)], withTyped("NewDurableQueue", func(o *options) store[elem[T]] {
+		w.mem = newChunkList[elem[T]](o.initialCapacity, o.shrink)
+		return w
+	}))
+
+	b := newBuffer(ctx, opts, identity[T])
+
+	// Through the whole store, so features such as WithSizer account for them
+	w.replaying = true
+	b.restore(restored)
+	w.replaying = false
+
+	q := startQueue(b)
+	q.durable = true
+
+	return q, nil
+}
+
+// openWAL replays the log in dir, and returns the messages that were never popped.
+func openWAL[T any](dir string, codec Codec[T]) (*wal[T], []T, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, err
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := &wal[T]{dir: dir, codec: codec, maxSize: walSegmentSize}
+
+	// Segments are named after their first index, zero-padded so they sort
+	slices.Sort(names)
+
+	var pushed []T
+	for _, name := range names {
+		first, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(name), "wal-"), ".log"), 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unboundedchannel: unexpected WAL segment %s", name)
+		}
+
+		// Messages before a segment's first were fully delivered, and their segments deleted
+		if len(w.segments) == 0 {
+			w.pushed, w.popped = first, first
+		}
+
+		w.segments = append(w.segments, first)
+		if pushed, err = w.replay(name, pushed); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// pushed holds the messages from the first segment's on, of which those before popped were delivered
+	start := w.segments0()
+	restored := pushed[min(int(w.popped-start), len(pushed)):]
+
+	if err := w.roll(); err != nil {
+		return nil, nil, err
+	}
+
+	if w.trim(); w.err != nil {
+		return nil, nil, w.err
+	}
+
+	return w, restored, nil
+}
+
+// segments0 returns the index of the first message of the oldest segment, or pushed if there is none.
+func (w *wal[T]) segments0() uint64 {
+	if len(w.segments) == 0 {
+		return w.pushed
+	}
+
+	return w.segments[0]
+}
+
+// replay reads the records of a segment, appending its messages to pushed.
+// A record torn by a crash was never synced, so never delivered, and is cut off.
+func (w *wal[T]) replay(name string, pushed []T) ([]T, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		// Where the record starts, should it be torn
+		pos, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		pos -= int64(r.Buffered())
+
+		kind, err := r.ReadByte()
+		if err == io.EOF {
+			return pushed, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var v T
+		var popped uint64
+		switch kind {
+		case walPush:
+			v, err = w.readPush(r)
+		case walPop:
+			popped, err = binary.ReadUvarint(r)
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+		default:
+			return nil, fmt.Errorf("unboundedchannel: corrupt WAL segment %s", name)
+		}
+
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return pushed, os.Truncate(name, pos)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if kind == walPush {
+			pushed = append(pushed, v)
+			w.pushed++
+		} else {
+			w.popped = max(w.popped, popped)
+		}
+	}
+}
+
+func (w *wal[T]) readPush(r *bufio.Reader) (T, error) {
+	size, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return *new(T), err
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		// A header with no payload after it is as torn as one cut mid-payload
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return *new(T), err
+	}
+
+	return w.codec.Decode(data)
+}
+
+// roll starts a new segment for the records to come, named after the next message.
+func (w *wal[T]) roll() error {
+	if w.file != nil {
+		if err := w.sync(); err != nil {
+			return err
+		}
+
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(w.segment(w.pushed), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if len(w.segments) == 0 || w.segments[len(w.segments)-1] != w.pushed {
+		w.segments = append(w.segments, w.pushed)
+	}
+
+	w.file, w.w, w.size = f, bufio.NewWriter(f), 0
+	return nil
+}
+
+func (w *wal[T]) len() int {
+	return w.mem.len()
+}
+
+func (w *wal[T]) push(e elem[T]) {
+	w.mem.push(e)
+	if w.replaying || w.err != nil {
+		return
+	}
+
+	data, err := w.codec.Encode(e.v)
+	if err != nil {
+		w.err = err
+		return
+	}
+
+	var header [1 + binary.MaxVarintLen64]byte
+	header[0] = walPush
+	n := 1 + binary.PutUvarint(header[1:], uint64(len(data)))
+
+	w.write(header[:n], data)
+	w.pushed++
+	w.dirty = true
+}
+
+// peek syncs pending pushes before returning the head, since peeking comes before delivering.
+func (w *wal[T]) peek() elem[T] {
+	if w.dirty && w.err == nil {
+		w.err = w.sync()
+	}
+
+	return w.mem.peek()
+}
+
+func (w *wal[T]) pop() elem[T] {
+	e := w.mem.pop()
+	if w.err != nil || w.retained {
+		return e
+	}
+
+	w.popped++
+
+	var record [1 + binary.MaxVarintLen64]byte
+	record[0] = walPop
+	n := 1 + binary.PutUvarint(record[1:], w.popped)
+	w.write(record[:n])
+
+	w.trim()
+
+	if w.size >= w.maxSize && w.err == nil {
+		w.err = w.roll()
+	}
+
+	return e
+}
+
+// walk goes through the messages in memory, so a snapshot logs nothing.
+func (w *wal[T]) walk(fn func(elem[T]) bool) bool {
+	return w.mem.walk(fn)
+}
+
+func (w *wal[T]) walkable() bool {
+	return true
+}
+
+// trim deletes the oldest segments once all their messages were delivered.
+func (w *wal[T]) trim() {
+	for len(w.segments) > 1 && w.segments[1] <= w.popped && w.err == nil {
+		w.err = os.Remove(w.segment(w.segments[0]))
+		w.segments = w.segments[1:]
+	}
+}
+
+// segment returns the name of the segment whose first message is first.
+func (w *wal[T]) segment(first uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("wal-%020d.log", first))
+}
+
+// write appends parts to the current segment.
+func (w *wal[T]) write(parts ...[]byte) {
+	for _, p := range parts {
+		if w.err != nil {
+			return
+		}
+
+		n, err := w.w.Write(p)
+		w.size += int64(n)
+		w.err = err
+	}
+}
+
+// sync writes buffered records and waits for the disk to persist them.
+func (w *wal[T]) sync() error {
+	w.dirty = false
+
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+
+	return w.file.Sync()
+}
+
+// failure returns the error that keeps the WAL from logging.
+func (w *wal[T]) failure() error {
+	return w.err
+}
+
+// retain stops logging pops, so the messages the buffer discards as it exits are restored next time.
+func (w *wal[T]) retain() {
+	w.retained = true
+}
+
+// close syncs the last records and closes the current segment as the buffer exits.
+func (w *wal[T]) close() {
+	if w.err == nil {
+		w.err = w.sync()
+	}
+
+	w.file.Close()
+}
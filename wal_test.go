@@ -0,0 +1,215 @@
+package unboundedchannel
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// walRecord is a record of a test segment, along with what it means once replayed.
+type walRecord struct {
+	data   []byte
+	push   int  // Message pushed, if a push
+	popped int  // Messages popped so far, if a pop
+	isPush bool // Whether the record is a push
+}
+
+func pushRecord(v int) walRecord {
+	data := []byte(strconv.Itoa(v))
+	r := append([]byte{walPush}, binary.AppendUvarint(nil, uint64(len(data)))...)
+	return walRecord{data: append(r, data...), push: v, isPush: true}
+}
+
+func popRecord(popped int) walRecord {
+	return walRecord{data: binary.AppendUvarint([]byte{walPop}, uint64(popped)), popped: popped}
+}
+
+func openTestWAL(t *testing.T, dir string) *Queue[int] {
+	t.Helper()
+
+	q, err := NewDurableQueue[int](context.Background(), dir, JSONCodec[int]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return q
+}
+
+func walSegments(t *testing.T, dir string) []string {
+	t.Helper()
+
+	names, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, name := range names {
+		names[i] = filepath.Base(name)
+	}
+
+	return names
+}
+
+// TestWALTornRecord cuts a segment at every byte, as a crash could, and checks that reopening it restores the
+// messages of the whole records and cuts off the torn one.
+func TestWALTornRecord(t *testing.T) {
+	records := []walRecord{pushRecord(10), pushRecord(200), popRecord(1), pushRecord(3000), popRecord(2), pushRecord(4)}
+
+	var segment []byte
+	for _, r := range records {
+		segment = append(segment, r.data...)
+	}
+
+	for cut := 0; cut <= len(segment); cut++ {
+		t.Run(strconv.Itoa(cut), func(t *testing.T) {
+			// What the whole records before cut restore, and where the torn one starts
+			var pushed []int
+			var popped, pos int
+			for _, r := range records {
+				if pos+len(r.data) > cut {
+					break
+				}
+
+				pos += len(r.data)
+				if r.isPush {
+					pushed = append(pushed, r.push)
+				} else {
+					popped = r.popped
+				}
+			}
+
+			dir := t.TempDir()
+			name := filepath.Join(dir, "wal-00000000000000000000.log")
+			if err := os.WriteFile(name, segment[:cut], 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			q := openTestWAL(t, dir)
+			defer q.Discard()
+
+			if got, _ := q.Snapshot(); !slices.Equal(got, pushed[popped:]) {
+				t.Errorf("restored %v, want %v", got, pushed[popped:])
+			}
+
+			fi, err := os.Stat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Size() != int64(pos) {
+				t.Errorf("segment is %d bytes, want it cut at %d", fi.Size(), pos)
+			}
+		})
+	}
+}
+
+// TestWALRestarts checks that restarts and full segments start new segments, and that segments are only
+// deleted once all their messages were delivered.
+func TestWALRestarts(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	q := openTestWAL(t, dir)
+	for i := range 3 {
+		q.Push(ctx, i)
+	}
+	q.Discard()
+
+	// Reopening starts a segment after the messages of the first
+	q = openTestWAL(t, dir)
+	if got, _ := q.Snapshot(); !slices.Equal(got, []int{0, 1, 2}) {
+		t.Fatalf("restored %v, want [0 1 2]", got)
+	}
+	if got := walSegments(t, dir); len(got) != 2 || got[1] != "wal-00000000000000000003.log" {
+		t.Fatalf("segments %v, want a second one starting at 3", got)
+	}
+
+	q.Push(ctx, 3)
+	q.Push(ctx, 4)
+	for i := range 3 {
+		if v, _ := q.Pop(ctx); v != i {
+			t.Fatalf("popped %d, want %d", v, i)
+		}
+	}
+
+	// Every message of the first segment was delivered, and logged as such by the time Snapshot is served
+	q.Snapshot()
+	if got := walSegments(t, dir); !slices.Equal(got, []string{"wal-00000000000000000003.log"}) {
+		t.Fatalf("segments %v, want only the second", got)
+	}
+	q.Discard()
+
+	q = openTestWAL(t, dir)
+	if got, _ := q.Snapshot(); !slices.Equal(got, []int{3, 4}) {
+		t.Fatalf("restored %v, want [3 4]", got)
+	}
+	q.Discard()
+}
+
+func TestWALRoll(t *testing.T) {
+	defer func(size int64) { walSegmentSize = size }(walSegmentSize)
+	walSegmentSize = 16
+
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	q := openTestWAL(t, dir)
+	for i := range 10 {
+		q.Push(ctx, i)
+	}
+	for i := range 5 {
+		q.Pop(ctx)
+		if n := len(walSegments(t, dir)); n > 2 {
+			t.Fatalf("%d segments after %d pops, want delivered ones deleted", n, i+1)
+		}
+	}
+
+	q.Snapshot()
+	if n := len(walSegments(t, dir)); n != 2 {
+		t.Fatalf("%d segments, want a full one and the next", n)
+	}
+	q.Discard()
+
+	q = openTestWAL(t, dir)
+	if got, _ := q.Snapshot(); !slices.Equal(got, []int{5, 6, 7, 8, 9}) {
+		t.Fatalf("restored %v, want [5 6 7 8 9]", got)
+	}
+	q.Discard()
+}
+
+// TestWALSnapshot checks that reading the messages of a durable queue doesn't log them again.
+func TestWALSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	q := openTestWAL(t, dir)
+	defer q.Discard()
+
+	for i := range 100 {
+		q.Push(ctx, i)
+	}
+
+	// Synced by the first, so the size only changes if the others write
+	q.Inspect(1)
+	name := filepath.Join(dir, walSegments(t, dir)[0])
+	before, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 5 {
+		q.Inspect(1)
+		q.Snapshot()
+	}
+
+	after, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() != before.Size() {
+		t.Errorf("segment grew from %d to %d bytes", before.Size(), after.Size())
+	}
+}
@@ -0,0 +1,100 @@
+package unboundedchannel
+
+// weighed is a store that keeps the total size of its messages, as measured by WithSizer.
+type weighed[T any] struct {
+	store[elem[T]]
+	size   func(T) int
+	total  int
+	budget *Budget // Charged with every change to total, if set by WithBudget
+
+	// Set by the inner store while pushing, if it folded the message into a pending one
+	folded        bool
+	old, combined elem[T]
+}
+
+// folder is implemented by stores that may fold a pushed message into a pending one, which then report it
+// through onFold so the weight stays accurate.
+type folder[E any] interface {
+	setOnFold(func(old, combined E))
+}
+
+func newWeighed[T any](inner store[elem[T]], size func(T) int, budget *Budget) *weighed[T] {
+	s := &weighed[T]{store: inner, size: size, budget: budget}
+
+	if f, ok := inner.(folder[elem[T]]); ok {
+		f.setOnFold(func(old, combined elem[T]) {
+			s.folded, s.old, s.combined = true, old, combined
+		})
+	}
+
+	return s
+}
+
+func (s *weighed[T]) push(e elem[T]) {
+	s.folded = false
+	s.store.push(e)
+
+	if s.folded {
+		s.add(s.size(s.combined.v) - s.size(s.old.v))
+		s.old, s.combined = elem[T]{}, elem[T]{}
+	} else {
+		s.add(s.size(e.v))
+	}
+}
+
+func (s *weighed[T]) pop() elem[T] {
+	e := s.store.pop()
+	s.add(-s.size(e.v))
+
+	return e
+}
+
+func (s *weighed[T]) add(n int) {
+	s.total += n
+	if s.budget != nil {
+		s.budget.charge(n)
+	}
+}
+
+func (s *weighed[T]) folds(e elem[T]) bool {
+	return folds(s.store, e)
+}
+
+// walkable and walk forward to the inner store, whose messages weigh the same either way.
+func (s *weighed[T]) walkable() bool {
+	return canWalk(s.store)
+}
+
+func (s *weighed[T]) walk(fn func(elem[T]) bool) bool {
+	return s.store.(walker[elem[T]]).walk(fn)
+}
+
+// release gives back to the budget what the messages left in the store use, once the buffer has exited.
+func (s *weighed[T]) release() {
+	if s.budget != nil {
+		s.budget.charge(-s.total)
+	}
+}
+
+// close forwards to the inner store, so it still releases its resources.
+func (s *weighed[T]) close() {
+	if c, ok := s.store.(closer); ok {
+		c.close()
+	}
+}
+
+// failure forwards to the inner store, so it still stops the buffer.
+func (s *weighed[T]) failure() error {
+	if f, ok := s.store.(failing); ok {
+		return f.failure()
+	}
+
+	return nil
+}
+
+// retain forwards to the inner store, so it still keeps its messages.
+func (s *weighed[T]) retain() {
+	if r, ok := s.store.(retainer); ok {
+		r.retain()
+	}
+}
@@ -0,0 +1,124 @@
+package unboundedchannel
+
+import (
+	"context"
+	"time"
+)
+
+// Window is a group of messages written to in from Start, included, to End, excluded, as delivered by
+// NewTumblingWindows and NewSlidingWindows.
+type Window[T any] struct {
+	Start, End time.Time
+	Items      []T
+}
+
+// NewTumblingWindows returns a pair of channels (in, out) where out delivers the messages written to in grouped
+// by time of arrival into consecutive windows of the given size, aligned on multiples of size since the zero
+// time. Each window is offered once it ends, in order, and is buffered until the consumer takes it; windows
+// without messages are skipped. Closing in offers the open window right away.
+// NewTumblingWindows panics if size is not positive.
+func NewTumblingWindows[T any](ctx context.Context, size time.Duration) (chan<- T, <-chan Window[T]) {
+	return NewSlidingWindows[T](ctx, size, size)
+}
+
+// NewSlidingWindows returns a pair of channels (in, out) like NewTumblingWindows, except that a window of the
+// given size starts every slide, so windows overlap and each message is part of about size/slide of them.
+// NewSlidingWindows panics if size is not positive, or slide is not positive or greater than size.
+func NewSlidingWindows[T any](ctx context.Context, size, slide time.Duration) (chan<- T, <-chan Window[T]) {
+	if size <= 0 || slide <= 0 || slide > size {
+		panic("unboundedchannel: window size must be positive, and slide positive and at most size")
+	}
+
+	in := make(chan T)
+	out := make(chan Window[T])
+
+	// Start buffering
+	go bufferWindows(ctx, in, out, size, slide)
+
+	return in, out
+}
+
+// bufferWindows groups messages from in into windows, offering them on out as they end.
+func bufferWindows[T any](ctx context.Context, in <-chan T, out chan<- Window[T], size, slide time.Duration) {
+	defer close(out)
+
+	var open []Window[T]                     // Windows that haven't ended yet, by start
+	ended := newChunkList[Window[T]](0, nil) // Windows waiting for the consumer
+
+	clock := clockFrom(ctx)
+	timer := stoppedTimer(clock) // Fires when the first open window ends
+	defer timer.Stop()
+
+	for {
+		now := clock.Now()
+		for len(open) > 0 && !now.Before(open[0].End) {
+			ended.push(open[0])
+			open[0] = Window[T]{}
+			open = open[1:]
+		}
+
+		// Only offer a window once it has ended
+		var send chan<- Window[T]
+		var head Window[T]
+		if ended.len() > 0 {
+			send, head = out, ended.peek()
+		} else if in == nil {
+			return // Intake is closed and every window was delivered
+		}
+
+		var wake <-chan time.Time
+		if len(open) > 0 {
+			timer.Reset(open[0].End.Sub(now))
+			wake = timer.C()
+		}
+
+		select {
+		case v, ok := <-in:
+			if !ok {
+				// Offer the open windows right away
+				for _, w := range open {
+					ended.push(w)
+				}
+
+				in, open = nil, nil
+				continue
+			}
+
+			open = addToWindows(open, v, clock.Now(), size, slide)
+		case send <- head:
+			ended.pop()
+		case <-wake:
+			// Windows that ended are moved on the next iteration
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// addToWindows adds v, arriving at now, to every window that contains now, opening those missing.
+// Windows open as messages arrive, so those already open that contain now are the last ones, and those
+// missing come after them.
+func addToWindows[T any](open []Window[T], v T, now time.Time, size, slide time.Duration) []Window[T] {
+	first := now.Add(-size).Truncate(slide).Add(slide) // Start of the oldest window containing now
+	last := now.Truncate(slide)
+
+	i := len(open)
+	for i > 0 && !open[i-1].Start.Before(first) {
+		i--
+	}
+
+	for j := i; j < len(open); j++ {
+		open[j].Items = append(open[j].Items, v)
+	}
+
+	start := first
+	if len(open) > i {
+		start = open[len(open)-1].Start.Add(slide)
+	}
+
+	for ; !start.After(last); start = start.Add(slide) {
+		open = append(open, Window[T]{Start: start, End: start.Add(size), Items: []T{v}})
+	}
+
+	return open
+}
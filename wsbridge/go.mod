@@ -0,0 +1,9 @@
+module github.com/launch-lab-public/unboundedchannel/wsbridge
+
+go 1.23.5
+
+require github.com/launch-lab-public/unboundedchannel v0.0.0
+
+require github.com/coder/websocket v1.8.12
+
+replace github.com/launch-lab-public/unboundedchannel => ../
@@ -0,0 +1,156 @@
+// Package wsbridge connects an unboundedchannel buffer to WebSocket connections, encoded with an
+// unboundedchannel.Codec, for example to feed live-updating UIs from an unbounded event stream.
+//
+// A Bridge writes the messages read from a buffer's output to a connection, and writes the messages the
+// connection receives to a buffer's input. Connections come and go while the buffer keeps what wasn't sent
+// yet, and a message whose write failed is sent first on the next connection. WebSocket has no
+// acknowledgments though, so messages written just before a connection broke may never reach the peer:
+//
+//	b := wsbridge.New(unboundedchannel.JSONCodec[Update]{}, out, in)
+//	for {
+//		conn, _, err := websocket.Dial(ctx, url, nil)
+//		if err == nil {
+//			err = b.Serve(ctx, conn)
+//		}
+//		// Back off, then reconnect
+//	}
+package wsbridge
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/coder/websocket"
+
+	"github.com/launch-lab-public/unboundedchannel"
+)
+
+// Bridge pumps messages between a buffer and one WebSocket connection at a time.
+type Bridge[T any] struct {
+	// Type is the frame type of the messages written, websocket.MessageText if zero. Set it before Serve.
+	Type websocket.MessageType
+
+	codec unboundedchannel.Codec[T]
+	out   <-chan T
+	in    chan<- T
+
+	mu      sync.Mutex // Held by Serve, so connections take turns
+	pending T          // Message read from out whose write failed, sent first on the next connection
+	has     bool       // Whether pending is set
+}
+
+// New returns a Bridge that writes the messages read from out to its connections, and writes the messages
+// they receive to in. Either may be nil to only pump messages one way, in which case received messages are
+// discarded. in is never closed by the Bridge.
+func New[T any](codec unboundedchannel.Codec[T], out <-chan T, in chan<- T) *Bridge[T] {
+	return &Bridge[T]{codec: codec, out: out, in: in}
+}
+
+// Serve pumps messages over conn until it fails or is closed by the peer, ctx is done, or out is closed and
+// drained, in which case Serve closes conn normally and returns nil. It otherwise closes conn and returns why
+// it stopped. A message read from out whose write failed is kept for the next call, and may then reach the peer
+// twice if the connection broke after it was written. Calls to Serve take turns, each waiting for the previous
+// one to return.
+func (b *Bridge[T]) Serve(ctx context.Context, conn *websocket.Conn) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Reading also answers pings and notices the peer closing the connection, so it runs even without in
+	var readErr error
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		readErr = b.read(ctx, conn)
+	}()
+
+	err := b.write(ctx, conn, read, &readErr)
+	if err == nil {
+		err = conn.Close(websocket.StatusNormalClosure, "")
+	} else {
+		conn.CloseNow()
+	}
+
+	// Wait for reading to stop, so nothing is written to in once Serve returns
+	cancel()
+	<-read
+
+	return err
+}
+
+// write sends the messages of out until it is closed and drained, ctx is done, or reading stops with readErr.
+func (b *Bridge[T]) write(ctx context.Context, conn *websocket.Conn, read <-chan struct{}, readErr *error) error {
+	typ := b.Type
+	if typ == 0 {
+		typ = websocket.MessageText
+	}
+
+	for {
+		if !b.has {
+			select {
+			case v, ok := <-b.out:
+				if !ok {
+					return nil
+				}
+
+				b.pending, b.has = v, true
+			case <-read:
+				return *readErr
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		data, err := b.codec.Encode(b.pending)
+		if err != nil {
+			b.pending, b.has = *new(T), false
+			conn.Close(websocket.StatusInternalError, "encoding message")
+			return err
+		}
+
+		if err := conn.Write(ctx, typ, data); err != nil {
+			return err
+		}
+
+		b.pending, b.has = *new(T), false
+	}
+}
+
+// read writes the messages received on conn to in, until reading fails.
+func (b *Bridge[T]) read(ctx context.Context, conn *websocket.Conn) error {
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			return err
+		}
+
+		if b.in == nil {
+			continue
+		}
+
+		v, err := b.codec.Decode(data)
+		if err != nil {
+			conn.Close(websocket.StatusInvalidFramePayloadData, "decoding message")
+			return err
+		}
+
+		select {
+		case b.in <- v:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ServeHTTP accepts a WebSocket connection and serves it with Serve, for as long as the request lasts.
+func (b *Bridge[T]) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	conn, err := websocket.Accept(w, req, nil)
+	if err != nil {
+		return // Accept already replied
+	}
+
+	b.Serve(req.Context(), conn)
+}